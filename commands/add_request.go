@@ -66,6 +66,24 @@ func AddRequestCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
+			// Optional variant name, for several requests with the same method and URL
+			variantPrompt := promptui.Prompt{
+				Label: "Enter variant name (optional, e.g., invalid-email)",
+				Validate: func(input string) error {
+					if strings.ContainsAny(strings.TrimSpace(input), `/\ `) {
+						return fmt.Errorf("variant name cannot contain spaces or slashes")
+					}
+					return util.ValidateVariantName(strings.TrimSpace(input))
+				},
+				Stdout: os.Stdout,
+			}
+			variant, err := variantPrompt.Run()
+			if err != nil {
+				fmt.Printf("Prompt failed: %v\n", err)
+				os.Exit(1)
+			}
+			variant = strings.TrimSpace(variant)
+
 			// Body Type Menu (only for body-supporting methods)
 			body := util.Body{}
 			bodyMethods := map[string]bool{
@@ -107,8 +125,11 @@ func AddRequestCmd() *cobra.Command {
 				Body:    body,
 			}
 
-			// Create file path: requests/<dirPath>/<method>.yaml
+			// Create file path: requests/<dirPath>/<method>[.<variant>].yaml
 			fileName := fmt.Sprintf("%s.yaml", method)
+			if variant != "" {
+				fileName = fmt.Sprintf("%s.%s.yaml", method, variant)
+			}
 			filePath := filepath.Join(util.RequestsDir, dirPath, fileName)
 			if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
 				fmt.Printf("Error creating request directory: %v\n", err)
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/moshe5745/localpost/util"
+	"github.com/spf13/cobra"
+)
+
+// errBaselineDeclined is returned by acceptBaseline when the user does not accept the change.
+var errBaselineDeclined = errors.New("baseline not changed")
+
+// baselineTarget resolves a request path argument to its file and proposes the schema
+// inferred from its recorded responses, with the diff against the current baseline.
+func baselineTarget(requestPath string, status int) util.BaselineProposal {
+	filePath, _, err := util.ResolveRequestPath(strings.TrimSuffix(requestPath, ".yaml"))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	proposal, err := util.ProposeBaseline(filePath, status)
+	if err != nil {
+		fmt.Printf("Error inferring schema: %v\n", err)
+		os.Exit(1)
+	}
+	return proposal
+}
+
+// acceptBaseline shows the diff of a proposed baseline and writes it once the user confirms,
+// or right away with yes. It is how every command that changes a baseline asks for approval.
+func acceptBaseline(proposal util.BaselineProposal, yes bool) error {
+	schemaPath := proposal.SchemaPath()
+	fmt.Printf("Changes to %s (%s):\n", schemaPath, proposal.Samples)
+	util.PrintBaselineDiff(os.Stdout, proposal.Diff)
+	if !yes {
+		prompt := promptui.Prompt{Label: "Accept the new baseline", IsConfirm: true}
+		if _, err := prompt.Run(); err != nil {
+			return errBaselineDeclined
+		}
+	}
+	if err := util.WriteBaseline(proposal.FilePath, proposal.Status, proposal.Schema); err != nil {
+		return err
+	}
+	fmt.Printf("Approved %s\n", schemaPath)
+	return nil
+}
+
+func BaselineCmd() *cobra.Command {
+	var status int
+	cmd := &cobra.Command{
+		Use:     "baseline",
+		Short:   "Review and approve schema baselines used by lpost test",
+		GroupID: "requests",
+		Long: `Schema baselines (*.jtd.json or *.schema.json next to each request file) are what lpost test validates
+responses against. They are only written after a diff was shown and accepted: by 'lpost baseline approve',
+'lpost test --update-baselines' or 'lpost request --infer-schema' (-y accepts without asking).
+'lpost request' and 'lpost test' record the JSON responses of each request (the last 20 per
+status by default, see schema.samples), and approve infers the new baseline from all of them.
+All 2xx responses share POST.jtd.json; error contracts such as POST.404.jtd.json are selected
+with --status.
+Use 'lpost schema refine' to re-infer many baselines at once after changing schema hints.`,
+		Example: `  lpost baseline approve /users/POST
+  lpost baseline diff /users/POST --status 400`,
+	}
+	cmd.PersistentFlags().IntVar(&status, "status", 200, "Status code of the baseline; every 2xx status shares the default one")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "diff <path>",
+		Short:             "Show how the recorded responses differ from the baseline",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: requestCompletionFunc,
+		Run: func(cmd *cobra.Command, args []string) {
+			proposal := baselineTarget(args[0], status)
+			if len(proposal.Diff) == 0 {
+				fmt.Printf("Baseline %s is up to date\n", proposal.SchemaPath())
+				return
+			}
+			fmt.Printf("Changes to %s (%s):\n", proposal.SchemaPath(), proposal.Samples)
+			util.PrintBaselineDiff(os.Stdout, proposal.Diff)
+		},
+	})
+
+	var yes bool
+	approveCmd := &cobra.Command{
+		Use:               "approve <path>",
+		Short:             "Accept the schema inferred from the recorded responses as the baseline",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: requestCompletionFunc,
+		Run: func(cmd *cobra.Command, args []string) {
+			proposal := baselineTarget(args[0], status)
+			if len(proposal.Diff) == 0 {
+				fmt.Printf("Baseline %s is up to date\n", proposal.SchemaPath())
+				return
+			}
+			if err := acceptBaseline(proposal, yes); errors.Is(err, errBaselineDeclined) {
+				fmt.Println("Baseline not changed")
+				os.Exit(1)
+			} else if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	approveCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Accept without asking for confirmation")
+	cmd.AddCommand(approveCmd)
+
+	return cmd
+}
@@ -0,0 +1,265 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/moshe5745/localpost/util"
+	"github.com/spf13/cobra"
+)
+
+// loadJarOrExit loads the cookie jar for the active environment.
+func loadJarOrExit() (*util.Jar, string) {
+	env, err := util.LoadEnv()
+	if err != nil {
+		fmt.Printf("Error loading env: %v\n", err)
+		os.Exit(1)
+	}
+	jar, err := util.LoadJar(env.Name)
+	if err != nil {
+		fmt.Printf("Error loading cookies: %v\n", err)
+		os.Exit(1)
+	}
+	return jar, env.Name
+}
+
+func saveJarOrExit(jar *util.Jar) {
+	if err := jar.Save(); err != nil {
+		fmt.Printf("Error saving cookies: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func filterCookies(cookies []util.StoredCookie, domain string) []util.StoredCookie {
+	var out []util.StoredCookie
+	for _, c := range cookies {
+		if c.InDomain(domain) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func formatExpiry(c util.StoredCookie) string {
+	if c.Expires.IsZero() {
+		return "session"
+	}
+	return fmt.Sprintf("%s (in %s)", c.Expires.Local().Format(time.DateTime), time.Until(c.Expires).Round(time.Second))
+}
+
+func CookiesCmd() *cobra.Command {
+	var domain string
+	cmd := &cobra.Command{
+		Use:     "cookies",
+		Short:   "Inspect and edit the cookie jar of the current environment",
+		GroupID: "environment",
+	}
+	cmd.PersistentFlags().StringVar(&domain, "domain", "", "Only cookies for this domain and its subdomains")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List cookies with their scope and expiry",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			jar, envName := loadJarOrExit()
+			cookies := filterCookies(jar.All(), domain)
+			if len(cookies) == 0 {
+				fmt.Printf("No cookies for environment '%s'\n", envName)
+				return
+			}
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Domain", "Path", "Name", "Value", "Flags", "Expires"})
+			for _, c := range cookies {
+				var flags []string
+				if c.HostOnly {
+					flags = append(flags, "host-only")
+				}
+				if c.Secure {
+					flags = append(flags, "secure")
+				}
+				if c.HttpOnly {
+					flags = append(flags, "http-only")
+				}
+				t.AppendRow(table.Row{c.Domain, c.Path, c.Name, c.Value, strings.Join(flags, " "), formatExpiry(c)})
+			}
+			t.Render()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "get <name>",
+		Short: "Print the value of a cookie",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			jar, _ := loadJarOrExit()
+			found := false
+			for _, c := range filterCookies(jar.All(), domain) {
+				if c.Name == args[0] {
+					fmt.Println(c.Value)
+					found = true
+				}
+			}
+			if !found {
+				fmt.Printf("Cookie %s not found\n", args[0])
+				os.Exit(1)
+			}
+		},
+	})
+
+	var path, expires string
+	var secure, httpOnly, hostOnly bool
+	setCmd := &cobra.Command{
+		Use:   "set <name> <value>",
+		Short: "Add or replace a cookie (requires --domain)",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if domain == "" {
+				fmt.Println("Error: --domain is required")
+				os.Exit(1)
+			}
+			c := util.StoredCookie{
+				Name:     args[0],
+				Value:    args[1],
+				Domain:   domain,
+				Path:     path,
+				HostOnly: hostOnly,
+				Secure:   secure,
+				HttpOnly: httpOnly,
+			}
+			if expires != "" {
+				if d, err := time.ParseDuration(expires); err == nil {
+					c.Expires = time.Now().Add(d)
+				} else if t, err := time.Parse(time.RFC3339, expires); err == nil {
+					c.Expires = t
+				} else {
+					fmt.Printf("Error: invalid --expires %q, use a duration (24h) or RFC3339 time\n", expires)
+					os.Exit(1)
+				}
+			}
+			jar, envName := loadJarOrExit()
+			jar.Put(c)
+			saveJarOrExit(jar)
+			fmt.Printf("Set cookie %s for %s in environment '%s'\n", c.Name, domain, envName)
+		},
+	}
+	setCmd.Flags().StringVar(&path, "path", "/", "Cookie path")
+	setCmd.Flags().StringVar(&expires, "expires", "", "Expiry as a duration (e.g. 24h) or RFC3339 time; session cookie if empty")
+	setCmd.Flags().BoolVar(&secure, "secure", false, "Only send over HTTPS")
+	setCmd.Flags().BoolVar(&httpOnly, "http-only", false, "Mark as HttpOnly")
+	setCmd.Flags().BoolVar(&hostOnly, "host-only", false, "Only send to the exact domain, not its subdomains")
+	cmd.AddCommand(setCmd)
+
+	var deletePath string
+	deleteCmd := &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a cookie",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			jar, _ := loadJarOrExit()
+			removed := jar.Remove(func(c util.StoredCookie) bool {
+				return c.Name == args[0] && c.InDomain(domain) && (deletePath == "" || c.Path == deletePath)
+			})
+			if removed == 0 {
+				fmt.Printf("Cookie %s not found\n", args[0])
+				os.Exit(1)
+			}
+			saveJarOrExit(jar)
+			fmt.Printf("Deleted %d cookie(s) named %s\n", removed, args[0])
+		},
+	}
+	deleteCmd.Flags().StringVar(&deletePath, "path", "", "Only delete the cookie with this path")
+	cmd.AddCommand(deleteCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Delete all cookies, or those of --domain",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			jar, envName := loadJarOrExit()
+			if domain == "" {
+				if err := util.ClearCookies(envName); err != nil {
+					fmt.Printf("Error clearing cookies: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Cleared all cookies for environment '%s'\n", envName)
+				return
+			}
+			removed := jar.Remove(func(c util.StoredCookie) bool { return c.InDomain(domain) })
+			saveJarOrExit(jar)
+			fmt.Printf("Cleared %d cookie(s) for %s\n", removed, domain)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "import <cookies.txt>",
+		Short: "Import cookies from a Netscape cookies.txt file (curl -c, browser exports)",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			file, err := os.Open(args[0])
+			if err != nil {
+				fmt.Printf("Error opening %s: %v\n", args[0], err)
+				os.Exit(1)
+			}
+			defer file.Close()
+			cookies, err := util.ParseNetscapeCookies(file)
+			if err != nil {
+				fmt.Printf("Error parsing %s: %v\n", args[0], err)
+				os.Exit(1)
+			}
+			cookies = filterCookies(cookies, domain)
+			jar, envName := loadJarOrExit()
+			imported, expired := 0, 0
+			for _, c := range cookies {
+				// Putting an expired cookie would delete the stored one instead
+				if c.Expired() {
+					expired++
+					continue
+				}
+				jar.Put(c)
+				imported++
+			}
+			saveJarOrExit(jar)
+			fmt.Printf("Imported %d cookie(s) into environment '%s'\n", imported, envName)
+			if expired > 0 {
+				fmt.Printf("Skipped %d expired cookie(s)\n", expired)
+			}
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "export [cookies.txt]",
+		Short: "Export cookies in Netscape cookies.txt format (stdout if no file is given)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			jar, _ := loadJarOrExit()
+			cookies := filterCookies(jar.All(), domain)
+			if len(args) == 0 {
+				if err := util.WriteNetscapeCookies(os.Stdout, cookies); err != nil {
+					fmt.Printf("Error writing cookies: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+			// Session cookies are credentials, so only the user may read the file
+			file, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				fmt.Printf("Error creating %s: %v\n", args[0], err)
+				os.Exit(1)
+			}
+			err = util.WriteNetscapeCookies(file, cookies)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				fmt.Printf("Error writing %s: %v\n", args[0], err)
+				os.Exit(1)
+			}
+		},
+	})
+
+	return cmd
+}
@@ -35,7 +35,7 @@ func InitCmd() *cobra.Command {
 						"dev": {
 							Vars: map[string]string{},
 							Login: &util.LoginConfig{
-								Request:     "POST_login.yaml",
+								Request:     "auth/login/POST",
 								TriggeredBy: []int{401},
 							},
 						},
@@ -91,10 +91,7 @@ func InitCmd() *cobra.Command {
 
 			// Create .ephemeral.yaml
 			if _, err := os.Stat(util.EphemeralFilePath); os.IsNotExist(err) {
-				ephData := util.Ephemeral{
-					Cookies: map[string]string{},
-					Vars:    map[string]string{},
-				}
+				ephData := util.Ephemeral{}
 				data, err := yaml.Marshal(ephData)
 				if err != nil {
 					fmt.Printf("Error marshaling ephemeral: %v\n", err)
@@ -111,12 +108,18 @@ func InitCmd() *cobra.Command {
 
 			// Create .gitignore
 			if _, err := os.Stat(util.GitignoreFilePath); os.IsNotExist(err) {
-				gitignoreContent := ".ephemeral.yaml\n"
+				gitignoreContent := ".ephemeral.yaml\n" + util.SamplesIgnoreEntry() + "\n"
 				if err := os.WriteFile(util.GitignoreFilePath, []byte(gitignoreContent), 0644); err != nil {
 					fmt.Printf("Error writing %s: %v\n", util.GitignoreFilePath, err)
 					os.Exit(1)
 				}
 				fmt.Printf("Created %s\n", util.GitignoreFilePath)
+			} else if added, err := util.IgnoreSamplesDir(); err != nil {
+				fmt.Printf("Error updating %s: %v\n", util.GitignoreFilePath, err)
+				os.Exit(1)
+			} else if added {
+				// Projects created before responses were recorded don't ignore them yet
+				fmt.Printf("Added %s to %s\n", util.SamplesIgnoreEntry(), util.GitignoreFilePath)
 			} else {
 				fmt.Printf("%s already exists\n", util.GitignoreFilePath)
 			}
@@ -3,7 +3,6 @@ package commands
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/moshe5745/localpost/util"
@@ -20,18 +19,15 @@ func ListCmd() *cobra.Command {
 				fmt.Println("Error: too many arguments")
 				os.Exit(1)
 			}
-			var requestPaths []string
-			filepath.Walk(util.RequestsDir, func(path string, info os.FileInfo, err error) error {
-				if !info.IsDir() && strings.HasSuffix(info.Name(), ".yaml") {
-					relPath, err := filepath.Rel(util.RequestsDir, path)
-					if err != nil {
-						return err
-					}
-					relPath = strings.ReplaceAll(relPath, string(os.PathSeparator), "/")
-					requestPaths = append(requestPaths, strings.TrimSuffix(relPath, ".yaml"))
-				}
-				return nil
-			})
+			// Variants (METHOD.name or METHOD@name) are listed next to their default request
+			requestPaths, err := util.RequestPaths()
+			if err != nil {
+				fmt.Printf("Error listing requests: %v\n", err)
+				os.Exit(1)
+			}
+			for i, requestPath := range requestPaths {
+				requestPaths[i] = strings.TrimPrefix(requestPath, "/")
+			}
 			fmt.Println(strings.Join(requestPaths, "\n"))
 		},
 	}
@@ -1,11 +1,13 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/fatih/color"
 	"github.com/moshe5745/localpost/util"
 	"github.com/spf13/cobra"
 )
@@ -15,34 +17,38 @@ func requestCompletionFunc(_ *cobra.Command, args []string, toComplete string) (
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
 
-	var requestPaths []string
-	err := filepath.Walk(util.RequestsDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".yaml") {
-			relPath, err := filepath.Rel(util.RequestsDir, path)
-			if err != nil {
-				return err
-			}
-			relPath = strings.ReplaceAll(relPath, string(os.PathSeparator), "/")
-			requestPath := "/" + strings.TrimSuffix(relPath, ".yaml")
-			if strings.HasPrefix(requestPath, "/"+strings.TrimPrefix(toComplete, "/")) {
-				requestPaths = append(requestPaths, requestPath)
-			}
-		}
-		return nil
-	})
+	requestPaths, err := util.RequestPaths()
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
 
-	return requestPaths, cobra.ShellCompDirectiveNoSpace
+	return util.CompleteRequestPath(requestPaths, toComplete), cobra.ShellCompDirectiveNoSpace
+}
+
+// paramCompletionFunc suggests NAME= for each path parameter of the chosen request.
+func paramCompletionFunc(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	filePath, _, err := util.ResolveRequestPath(args[0])
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	relPath, err := filepath.Rel(util.RequestsDir, filePath)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, name := range util.PathParams(relPath) {
+		names = append(names, name+"=")
+	}
+	return names, cobra.ShellCompDirectiveNoSpace
 }
 
 func RequestCmd() *cobra.Command {
-	var verbose bool
-	var inferSchema bool
+	var opts util.RequestOptions
+	var params []string
+	var inferSchema, yes bool
 
 	cmd := &cobra.Command{
 		Use:     "request <path>",
@@ -50,8 +56,14 @@ func RequestCmd() *cobra.Command {
 		Short:   "Execute a request from a YAML file in the requests/ directory",
 		Long: `Execute a request defined in a YAML file located in the requests/ directory.
 The path should be in the format /path/to/dir/METHOD (e.g., /user/POST or /api/v1/auth/login/POST).
-Use --infer-schema to generate a JTD schema from the response.
-Use --verbose to show detailed request and response information.`,
+Named variants of a request are run as /path/to/dir/METHOD.name or /path/to/dir/METHOD@name.
+The response is recorded so it can be accepted as the schema baseline with 'lpost baseline approve'.
+Use --infer-schema to review the baseline for the response status (e.g. POST.404.jtd.json) right away,
+like 'lpost baseline approve' does.
+Use --verbose to show detailed request and response information.
+Use --lenient to send the request even if some {VAR} placeholders are unresolved.
+Directories named {id} or :id are path parameters, resolved from variables, from --param id=42,
+or from the path itself (e.g., /users/42/GET runs /users/{id}/GET).`,
 		Args: cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			requestPath := args[0]
@@ -67,7 +79,11 @@ Use --verbose to show detailed request and response information.`,
 				fmt.Printf("Error: invalid request path '%s', expected format '/path/to/dir/METHOD'\n", requestPath)
 				os.Exit(1)
 			}
-			method := parts[len(parts)-1]
+			method, _, err := util.SplitRequestName(parts[len(parts)-1])
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 			validMethods := map[string]bool{
 				"GET": true, "POST": true, "PUT": true, "DELETE": true,
 				"PATCH": true, "HEAD": true, "OPTIONS": true, "TRACE": true,
@@ -77,18 +93,74 @@ Use --verbose to show detailed request and response information.`,
 				os.Exit(1)
 			}
 
+			// A concrete path like /users/42/GET matches the /users/{id}/GET request and binds id
 			filePath := filepath.Join(util.RequestsDir, requestPath+".yaml")
-			_, err := util.HandleRequest(filePath, verbose, inferSchema)
+			if _, err := os.Stat(filePath); err != nil {
+				resolved, bound, err := util.ResolveRequestPath(requestPath)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				filePath, opts.Params = resolved, bound
+			}
+			for _, kv := range params {
+				key, value, ok := strings.Cut(kv, "=")
+				if !ok || key == "" {
+					fmt.Printf("Error: invalid --param %q, expected NAME=VALUE\n", kv)
+					os.Exit(1)
+				}
+				if opts.Params == nil {
+					opts.Params = make(map[string]string)
+				}
+				opts.Params[key] = value
+			}
+
+			resp, err := util.HandleRequest(filePath, opts)
 			if err != nil {
 				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
 			}
+			if inferSchema {
+				reviewBaseline(filePath, resp, yes)
+			}
+			if failed := resp.FailedAssertions(); len(failed) > 0 {
+				fmt.Printf("%d of %d assertions failed\n", len(failed), len(resp.Assertions))
+				os.Exit(1)
+			}
 		},
 		ValidArgsFunction: requestCompletionFunc,
 	}
 
-	cmd.Flags().BoolVar(&inferSchema, "infer-schema", true, "Generate a JTD schema from the response")
-	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show detailed request and response information")
+	cmd.Flags().BoolVar(&inferSchema, "infer-schema", false, "Show the baseline inferred from the recorded responses and ask to accept it")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Accept the --infer-schema baseline without asking for confirmation")
+	cmd.Flags().BoolVarP(&opts.Verbose, "verbose", "v", false, "Show detailed request and response information")
+	cmd.Flags().BoolVar(&opts.Lenient, "lenient", false, "Send the request even if some placeholders are unresolved")
+	cmd.Flags().StringArrayVar(&params, "param", nil, "Set a path parameter (NAME=VALUE, repeatable)")
+	cmd.RegisterFlagCompletionFunc("param", paramCompletionFunc)
 
 	return cmd
 }
+
+// reviewBaseline proposes the baseline for the status of resp from the recorded responses and
+// writes it once accepted.
+func reviewBaseline(filePath string, resp util.Response, yes bool) {
+	if !resp.HasJSONBody() {
+		fmt.Println(color.HiYellowString("Baseline not updated: only JSON responses are used"))
+		return
+	}
+	proposal, err := util.ProposeBaseline(filePath, resp.StatusCode)
+	if err != nil {
+		fmt.Printf("Error inferring schema: %v\n", err)
+		os.Exit(1)
+	}
+	if len(proposal.Diff) == 0 {
+		fmt.Println("Baseline unchanged")
+		return
+	}
+	if err := acceptBaseline(proposal, yes); errors.Is(err, errBaselineDeclined) {
+		fmt.Println("Baseline not changed")
+	} else if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
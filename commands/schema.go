@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/moshe5745/localpost/util"
+	"github.com/spf13/cobra"
+)
+
+func SchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "schema",
+		Short:   "Infer schema baselines from recorded responses",
+		GroupID: "requests",
+	}
+
+	var yes, dryRun bool
+	refineCmd := &cobra.Command{
+		Use:   "refine [glob...]",
+		Short: "Re-infer baselines from the recorded responses of every matching request",
+		Long: `Re-infer the baseline of every request matching the globs (all requests by default) from its
+recorded responses, using the hints in the request's schema block:
+
+  schema:
+    format: json-schema              # jtd (default) or json-schema (*.schema.json)
+    samples: 50                      # Responses kept for inference (default 20)
+    enums: [status, items.*.kind]    # Strings inferred as an enum of the values seen
+    discriminators: [events.*.type]  # Tag properties of tagged unions
+    optional: [user.nickname]        # Properties that may be missing
+    timestamps: false                # Keep RFC 3339 strings as plain strings
+
+Each changed baseline is shown as a diff and written after confirmation. Baselines of error
+statuses, such as POST.404.jtd.json, are refined once they were approved with 'lpost baseline approve --status'.`,
+		Example: `  lpost schema refine
+  lpost schema refine 'users/**' --dry-run`,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			files, err := util.DiscoverRequests(util.TestFilter{Patterns: args})
+			if err != nil {
+				fmt.Printf("Error collecting requests: %v\n", err)
+				os.Exit(1)
+			}
+
+			var refined, unchanged, skipped int
+			for _, filePath := range files {
+				relPath, _ := filepath.Rel(util.RequestsDir, filePath)
+				name := strings.TrimSuffix(filepath.ToSlash(relPath), ".yaml")
+
+				statuses, err := util.SampleStatuses(filePath)
+				if err != nil {
+					fmt.Printf("Error reading samples of %s: %v\n", name, err)
+					os.Exit(1)
+				}
+				if len(statuses) == 0 {
+					skipped++
+					continue
+				}
+				for _, status := range statuses {
+					schema, samples, err := util.InferFromSamples(filePath, status)
+					if err != nil {
+						fmt.Printf("Error inferring schema of %s: %v\n", name, err)
+						os.Exit(1)
+					}
+					schemaPath := util.StatusSchemaPath(filePath, status)
+					current, err := util.ReadBaseline(filePath, status)
+					if err != nil {
+						fmt.Printf("Error reading baseline of %s: %v\n", name, err)
+						os.Exit(1)
+					}
+					// Error responses only get a baseline once one was approved for their status
+					if current == nil && status != 200 {
+						continue
+					}
+					diff, err := util.BaselineDiff(current, schema)
+					if err != nil {
+						fmt.Printf("Error comparing schemas of %s: %v\n", name, err)
+						os.Exit(1)
+					}
+					if len(diff) == 0 {
+						unchanged++
+						continue
+					}
+
+					fmt.Printf("%s (%s):\n", schemaPath, samples)
+					util.PrintBaselineDiff(os.Stdout, diff)
+					if dryRun {
+						refined++
+						continue
+					}
+					if !yes {
+						prompt := promptui.Prompt{Label: "Write " + schemaPath, IsConfirm: true}
+						if _, err := prompt.Run(); err != nil {
+							unchanged++
+							continue
+						}
+					}
+					if err := util.WriteBaseline(filePath, status, schema); err != nil {
+						fmt.Printf("Error: %v\n", err)
+						os.Exit(1)
+					}
+					refined++
+				}
+			}
+
+			verb := "Refined"
+			if dryRun {
+				verb = "Would refine"
+			}
+			fmt.Printf("%s %d baselines, %d unchanged, %d without recorded responses\n", verb, refined, unchanged, skipped)
+		},
+	}
+	refineCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Write every changed baseline without asking for confirmation")
+	refineCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show the diffs")
+	cmd.AddCommand(refineCmd)
+
+	return cmd
+}
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/moshe5745/localpost/util"
+	"github.com/spf13/cobra"
+)
+
+func SessionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "session",
+		Short:   "Show or clear session variables captured by set-env-var",
+		GroupID: "environment",
+		Long: `Session variables are captured from responses by set-env-var and stored in the
+gitignored .ephemeral.yaml, per environment. They override variables from config.yaml.
+Use 'persist: true' on a set-env-var entry to write it to config.yaml instead.`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Show session variables for the current environment",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			env, err := util.LoadEnv()
+			if err != nil {
+				fmt.Printf("Error loading env: %v\n", err)
+				os.Exit(1)
+			}
+			vars, err := util.SessionVars(env.Name)
+			if err != nil {
+				fmt.Printf("Error loading session: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Session for environment: %s\n", env.Name)
+			if len(vars) == 0 {
+				fmt.Println("No session variables set")
+				return
+			}
+			keys := make([]string, 0, len(vars))
+			for key := range vars {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Printf("%s: %s\n", key, vars[key])
+			}
+		},
+	})
+
+	var all bool
+	clearCmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Clear session variables for the current environment",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := ""
+			if !all {
+				env, err := util.LoadEnv()
+				if err != nil {
+					fmt.Printf("Error loading env: %v\n", err)
+					os.Exit(1)
+				}
+				envName = env.Name
+			}
+			if err := util.ClearSession(envName); err != nil {
+				fmt.Printf("Error clearing session: %v\n", err)
+				os.Exit(1)
+			}
+			if all {
+				fmt.Println("Cleared session variables for all environments")
+			} else {
+				fmt.Printf("Cleared session variables for environment '%s'\n", envName)
+			}
+		},
+	}
+	clearCmd.Flags().BoolVar(&all, "all", false, "Clear session variables for every environment")
+	cmd.AddCommand(clearCmd)
+
+	return cmd
+}
@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"os"
+	"sort"
 
 	"github.com/moshe5745/localpost/util"
 	"github.com/spf13/cobra"
@@ -34,11 +35,16 @@ func ShowEnvCmd() *cobra.Command {
 			}
 
 			fmt.Printf("Current environment: %s\n", env.Name)
-			if len(env.Vars) == 0 {
+			if len(env.Resolved) == 0 {
 				fmt.Println("No variables set")
 			} else {
-				for key, value := range env.Vars {
-					fmt.Printf("%s: %s\n", key, value)
+				keys := make([]string, 0, len(env.Resolved))
+				for key := range env.Resolved {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				for _, key := range keys {
+					fmt.Printf("%s: %s\n", key, env.Resolved[key])
 				}
 			}
 		},
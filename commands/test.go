@@ -1,16 +1,18 @@
 package commands
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/text"
-	jtd "github.com/jsontypedef/json-typedef-go"
 
 	"github.com/jedib0t/go-pretty/v6/progress"
 	"github.com/moshe5745/localpost/util"
@@ -18,34 +20,106 @@ import (
 )
 
 func TestCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "test",
-		Short: "Run all requests and validate against stored JTD schemas",
+	var lenient, updateBaselines, yes, failOnFlaky bool
+	var concurrency int
+	var reporter, reportFile string
+	var redact []string
+	var filter util.TestFilter
+	cmd := &cobra.Command{
+		Use:   "test [glob...]",
+		Short: "Run all requests and validate against stored schema baselines",
+		Long: `Run every request under requests/, or those matching the given path globs, and validate
+each response against the schema stored next to its request file for the response status:
+POST.jtd.json for any 2xx status, POST.400.jtd.json, POST.404.jtd.json and so on for error
+contracts. A status without a baseline fails the request as unexpected. Baselines are JSON Type
+Definition (*.jtd.json) or JSON Schema draft 2020-12 (*.schema.json). JSON Schema validation
+supports a subset of 2020-12 and fails on unevaluated*, $dynamicRef and remote $ref (see README).
+Globs match request paths such as users/{id}/GET: * and ? stay within a directory,
+** spans directories, and a path without wildcards selects everything below it.
+Requests run in parallel, except that a request waits for the requests in its depends-on list
+and is skipped if one of them fails. Requests under a folder's _setup directory run before the
+folder's requests, and those under _teardown run after them, even when they fail.
+A request with retries: in its file is retried with exponential backoff until it passes; one that
+passes only on a retry is reported as flaky.`,
+		Example: `  lpost test
+  lpost test users 'orders/**/POST*'
+  lpost test --tag smoke --exclude 'admin/**'
+  lpost test --concurrency 4 --fail-on-flaky
+  lpost test --reporter junit --report-file reports/lpost.xml
+  lpost test --reporter html --report-file reports/lpost.html --redact X-Session`,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
 		Run: func(cmd *cobra.Command, args []string) {
-			// Clear cookies
-			if err := util.ClearCookies(); err != nil {
-				fmt.Printf("Error clearing cookies: %v\n", err)
+			filter.Patterns = args
+			if reportFile != "" && reporter == "" {
+				reporter = "junit"
+			}
+			if reporter != "" && !slices.Contains(util.Reporters(), reporter) {
+				fmt.Printf("Error: unsupported reporter %q (expected %s)\n", reporter, strings.Join(util.Reporters(), ", "))
+				os.Exit(1)
+			}
+			if concurrency < 0 {
+				fmt.Println("Error: --concurrency must not be negative")
+				os.Exit(1)
+			}
+			// The progress view and request output go to stdout, so reports always go to a file
+			if reporter != "" && reportFile == "" {
+				fmt.Printf("Error: the %s reporter needs --report-file\n", reporter)
 				os.Exit(1)
 			}
-
-			// Execute login request with response output
 			env, err := util.LoadEnv()
 			if err != nil {
 				fmt.Printf("Error loading env: %v\n", err)
 				os.Exit(1)
 			}
+
+			// Clear cookies
+			if err := util.ClearCookies(env.Name); err != nil {
+				fmt.Printf("Error clearing cookies: %v\n", err)
+				os.Exit(1)
+			}
+
+			// Execute login request with response output
 			if env.Login != nil && env.Login.Request != "" {
-				_, err := util.HandleRequest(env.Login.Request, true, false)
+				_, err := util.HandleRequest(util.RequestFilePath(env.Login.Request), util.RequestOptions{Verbose: true, Lenient: lenient})
 				if err != nil {
 					fmt.Printf("Error executing login request %s: %v\n", env.Login.Request, err)
 					os.Exit(1)
 				}
 			}
 
-			// Collect requests
-			files, err := os.ReadDir(util.RequestsDir)
+			// Fetch the OAuth2 token once, so concurrent requests don't each hit the token endpoint
+			if env.Login != nil && env.Login.OAuth2 != nil {
+				tokenResp, err := util.EnsureOAuthToken(env, "")
+				if err != nil {
+					fmt.Printf("Error fetching oauth2 token: %v\n", err)
+					os.Exit(1)
+				}
+				if tokenResp != nil {
+					fmt.Printf("OAuth2 token from %s -> %d (%dms)\n", tokenResp.ReqURL, tokenResp.StatusCode, tokenResp.Duration.Milliseconds())
+				}
+			}
+
+			// Collect requests from the whole tree
+			files, err := util.DiscoverRequests(filter)
 			if err != nil {
-				fmt.Printf("Error reading requests dir: %v\n", err)
+				fmt.Printf("Error collecting requests: %v\n", err)
+				os.Exit(1)
+			}
+			if env.Login != nil && env.Login.Request != "" {
+				loginPath := filepath.Clean(util.RequestFilePath(env.Login.Request))
+				files = slices.DeleteFunc(files, func(path string) bool { return filepath.Clean(path) == loginPath })
+			}
+			if len(files) == 0 {
+				fmt.Println("No requests matched")
+				os.Exit(1)
+			}
+
+			// Order requests by depends-on and wrap folders in their setup and teardown hooks
+			plan, err := util.PlanTests(files)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
 			}
 
@@ -66,118 +140,194 @@ func TestCmd() *cobra.Command {
 			go pw.Render()
 
 			// Track failures and requests
-			var wg sync.WaitGroup
 			failed := false
 			mu := sync.Mutex{}
-			trackers := make(map[string]*progress.Tracker)
+			trackers := make([]*progress.Tracker, len(plan.Steps))
+			report := util.TestReport{Env: env.Name, StartedAt: time.Now(), Results: make([]util.TestResult, len(plan.Steps))}
+			var pendingBaselines []pendingBaseline
+
+			for i, step := range plan.Steps {
+				tracker := &progress.Tracker{
+					Message: fmt.Sprintf("%s idle", step.Name),
+					Total:   0,
+				}
+				pw.AppendTracker(tracker)
+				trackers[i] = tracker
+			}
+			record := func(i int, result util.TestResult) {
+				mu.Lock()
+				report.Results[i] = result
+				if result.Outcome == util.OutcomeFailed || result.Outcome == util.OutcomeError {
+					failed = true
+				}
+				mu.Unlock()
+			}
+
+			// runTest sends a request once and checks its response
+			runTest := func(step util.TestStep, t *progress.Tracker) (result util.TestResult) {
+				fn, path := step.Name, step.Path
+				result = util.TestResult{Name: fn, Outcome: util.OutcomePassed}
+
+				// Execute request
+				resp, err := util.HandleRequest(path, util.RequestOptions{Verbose: true, Lenient: lenient})
+				if err != nil {
+					result.Outcome, result.Message = util.OutcomeError, err.Error()
+					t.UpdateMessage(fmt.Sprintf("%s failed: %v", fn, err))
+					t.MarkAsErrored()
+					pw.Log(fmt.Sprintf("Validation failed for %s: %v", fn, err))
+					return
+				}
+
+				result.StatusCode = resp.StatusCode
+				result.Response = &resp
+
+				// Check expect block assertions
+				if failedAssertions := resp.FailedAssertions(); len(failedAssertions) > 0 {
+					result.Outcome, result.Message = util.OutcomeFailed, "assertions failed"
+					result.Assertions = failedAssertions
+					t.UpdateMessage(fmt.Sprintf("%s %d ✗ (assertions)", fn, resp.StatusCode))
+					t.MarkAsErrored()
+					pw.Log(fmt.Sprintf("Assertions failed for %s:", fn))
+					for _, a := range failedAssertions {
+						pw.Log(fmt.Sprintf("  - %s: %s", a.Name, a.Message))
+					}
+					return
+				}
 
-			for _, file := range files {
-				if !file.IsDir() && strings.HasSuffix(file.Name(), ".yaml") {
-					fileName := strings.TrimSuffix(file.Name(), ".yaml")
-					if env.Login != nil && fileName == strings.TrimSuffix(env.Login.Request, ".yaml") {
-						continue // Skip login request
+				// Hooks prepare and clean up test data, so they only need a 2xx status
+				if hook := step.Hook; hook != "" {
+					if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+						result.Outcome, result.Message = util.OutcomeFailed, fmt.Sprintf("%s returned status %d", strings.TrimPrefix(hook, "_"), resp.StatusCode)
+						t.UpdateMessage(fmt.Sprintf("%s %d ✗", fn, resp.StatusCode))
+						t.MarkAsErrored()
+						pw.Log(fmt.Sprintf("%s failed: %s", fn, result.Message))
+						return
 					}
+					t.Total = 100
+					t.UpdateMessage(text.FgGreen.Sprintf("%s %d ✓", fn, resp.StatusCode))
+					t.MarkAsDone()
+					return
+				}
+
+				// Responses are validated against the baseline of their status: POST.jtd.json for
+				// any 2xx, POST.404.jtd.json and the like otherwise. A status that is neither listed
+				// in expect.status nor has a baseline is unexpected.
+				schemaPath := util.StatusSchemaPath(path, resp.StatusCode)
+				_, statErr := os.Stat(schemaPath)
+				noBaseline := os.IsNotExist(statErr)
+				if noBaseline && !util.ExpectsStatus(path, resp.StatusCode) {
+					result.Outcome = util.OutcomeFailed
+					result.Message = fmt.Sprintf("unexpected status %d: no baseline at %s", resp.StatusCode, schemaPath)
+					t.UpdateMessage(fmt.Sprintf("%s %d ✗ (unexpected status)", fn, resp.StatusCode))
+					t.MarkAsErrored()
+					pw.Log(fmt.Sprintf("Unexpected status %d for %s: no baseline at %s (add it to expect.status, or run 'lpost baseline approve /%s --status %d' if it is expected)", resp.StatusCode, fn, schemaPath, fn, resp.StatusCode))
+					return
+				}
 
-					wg.Add(1)
-					tracker := &progress.Tracker{
-						Message: fmt.Sprintf("%s idle", fileName),
-						Total:   0,
+				// A response without a JSON body, such as a 204 or an HTML error page, has no schema
+				// to validate. It only fails if a baseline says a JSON body was expected.
+				if noBaseline && !resp.HasJSONBody() {
+					t.Total = 100
+					t.UpdateMessage(text.FgGreen.Sprintf("%s %d ✓ (no JSON body)", fn, resp.StatusCode))
+					t.MarkAsDone()
+					return
+				}
+
+				// Queue the response's baseline for review after the run instead of validating against
+				// the old one. Error baselines are only updated once they were approved for their status.
+				if updateBaselines {
+					mu.Lock()
+					pendingBaselines = append(pendingBaselines, pendingBaseline{name: fn, path: path, status: resp.StatusCode})
+					mu.Unlock()
+					t.Total = 100
+					t.UpdateMessage(fmt.Sprintf("%s %d ✓ (baseline to review)", fn, resp.StatusCode))
+					t.MarkAsDone()
+					return
+				}
+
+				// Validate schema
+				schemaData, err := os.ReadFile(schemaPath)
+				if err != nil {
+					result.Outcome, result.Message = util.OutcomeFailed, fmt.Sprintf("no baseline at %s", schemaPath)
+					t.UpdateMessage(fmt.Sprintf("%s ✗ (schema not found)", fn))
+					t.MarkAsErrored()
+					pw.Log(fmt.Sprintf("Validation failed for %s: no baseline at %s (run 'lpost baseline approve /%s' or 'lpost test --update-baselines')", fn, schemaPath, fn))
+					return
+				}
+
+				var doc interface{}
+				if err := json.Unmarshal([]byte(resp.RespBody), &doc); err != nil {
+					result.Outcome, result.Message = util.OutcomeFailed, "response body is not valid JSON"
+					t.UpdateMessage(fmt.Sprintf("%s %d ✗", fn, resp.StatusCode))
+					t.MarkAsErrored()
+					pw.Log(fmt.Sprintf("Validation failed for %s: invalid response body", fn))
+					return
+				}
+				validateErrors, err := util.SchemaFormatOf(schemaPath).Validate(schemaData, doc)
+				if err != nil {
+					result.Outcome, result.Message = util.OutcomeError, fmt.Sprintf("%s: %v", schemaPath, err)
+					t.UpdateMessage(fmt.Sprintf("%s ✗ (invalid schema)", fn))
+					t.MarkAsErrored()
+					pw.Log(fmt.Sprintf("Validation failed for %s: %s: %v", fn, schemaPath, err))
+					return
+				}
+				if len(validateErrors) != 0 {
+					result.Outcome, result.Message = util.OutcomeFailed, fmt.Sprintf("response does not match %s", schemaPath)
+					result.SchemaErrors = validateErrors
+					t.UpdateMessage(fmt.Sprintf("%s %d ✗", fn, resp.StatusCode))
+					t.MarkAsErrored()
+					pw.Log(fmt.Sprintf("Validation failed for %s:", fn))
+					for _, e := range validateErrors {
+						pw.Log(fmt.Sprintf("  - %s", e))
 					}
+					return
+				}
+
+				// Success with status code
+				var statusColor text.Color
+				switch {
+				case resp.StatusCode >= 200 && resp.StatusCode < 300:
+					statusColor = text.FgGreen
+				case resp.StatusCode >= 400 && resp.StatusCode < 500:
+					statusColor = text.FgYellow
+				case resp.StatusCode >= 500:
+					statusColor = text.FgRed
+				default:
+					statusColor = text.FgWhite
+				}
+				t.Total = 100 // Switch to determinate progress
+				t.UpdateMessage(statusColor.Sprintf("%s %d ✓", fn, resp.StatusCode))
+				t.MarkAsDone()
+				return
+			}
+
+			// Independent requests run in parallel, each as soon as the requests it depends on are done.
+			// A request that does not pass is retried as often as its retries allow.
+			plan.Run(concurrency, func(i int, pause func(time.Duration)) bool {
+				step := plan.Steps[i]
+				start := time.Now()
+				result := runTest(step, trackers[i])
+				var retried []string
+				for attempt := 1; result.Outcome != util.OutcomePassed && attempt <= step.Retries.Count; attempt++ {
+					delay := step.Retries.Backoff(attempt)
+					pw.Log(fmt.Sprintf("Retrying %s in %s (%d of %d)", step.Name, delay, attempt, step.Retries.Count))
+					retried = append(retried, result.Message)
+					pause(delay)
+
+					tracker := &progress.Tracker{Message: fmt.Sprintf("%s retry %d/%d", step.Name, attempt, step.Retries.Count)}
 					pw.AppendTracker(tracker)
-					trackers[fileName] = tracker
-
-					go func(fn string, t *progress.Tracker) {
-						defer wg.Done()
-
-						// Execute request
-						resp, err := util.HandleRequest(fn, true, false)
-						if err != nil {
-							mu.Lock()
-							failed = true
-							mu.Unlock()
-							t.UpdateMessage(fmt.Sprintf("%s failed: %v", fn, err))
-							t.MarkAsErrored()
-							pw.Log(fmt.Sprintf("Validation failed for %s: %v", fn, err))
-							return
-						}
-
-						// Validate schema
-						schemaPath := filepath.Join(fn + ".jtd.json")
-						schemaData, err := os.ReadFile(schemaPath)
-						if err != nil {
-							mu.Lock()
-							failed = true
-							mu.Unlock()
-							t.UpdateMessage(fmt.Sprintf("%s ✗ (schema not found)", fn))
-							t.MarkAsErrored()
-							pw.Log(fmt.Sprintf("Validation failed for %s: schema file not found at %s", fn, schemaPath))
-							return
-						}
-
-						var schema jtd.Schema
-						if err := json.Unmarshal(schemaData, &schema); err != nil {
-							mu.Lock()
-							failed = true
-							mu.Unlock()
-							t.UpdateMessage(fmt.Sprintf("%s ✗ (invalid schema)", fn))
-							t.MarkAsErrored()
-							pw.Log(fmt.Sprintf("Validation failed for %s: invalid schema format", fn))
-							return
-						}
-
-						var doc interface{}
-						if err := json.Unmarshal([]byte(resp.RespBody), &doc); err != nil {
-							mu.Lock()
-							failed = true
-							mu.Unlock()
-							t.UpdateMessage(fmt.Sprintf("%s %d ✗", fn, resp.StatusCode))
-							t.MarkAsErrored()
-							pw.Log(fmt.Sprintf("Validation failed for %s: invalid response body", fn))
-							return
-						}
-						if validateErrors, err := jtd.Validate(schema, doc); len(validateErrors) != 0 || err != nil {
-							mu.Lock()
-							failed = true
-							mu.Unlock()
-							t.UpdateMessage(fmt.Sprintf("%s %d ✗", fn, resp.StatusCode))
-							t.MarkAsErrored()
-							pw.Log(fmt.Sprintf("Validation failed for %s:", fn))
-							for _, e := range validateErrors {
-								var msg string
-								instancePath := strings.Join(e.InstancePath, ".")
-								schemaPath := strings.Join(e.SchemaPath, ".")
-								if strings.HasSuffix(schemaPath, "required") || strings.HasSuffix(schemaPath, "properties") {
-									msg = fmt.Sprintf("  - Missing required property: %s", instancePath)
-								} else if strings.HasSuffix(schemaPath, "type") {
-									msg = fmt.Sprintf("  - Type mismatch at %s: schema path %s", instancePath, schemaPath)
-								} else {
-									msg = fmt.Sprintf("  - Validation error at %s: schema path %s", instancePath, schemaPath)
-								}
-								pw.Log(msg)
-							}
-							return
-						}
-
-						// Success with status code
-						var statusColor text.Color
-						switch {
-						case resp.StatusCode >= 200 && resp.StatusCode < 300:
-							statusColor = text.FgGreen
-						case resp.StatusCode >= 400 && resp.StatusCode < 500:
-							statusColor = text.FgYellow
-						case resp.StatusCode >= 500:
-							statusColor = text.FgRed
-						default:
-							statusColor = text.FgWhite
-						}
-						t.Total = 100 // Switch to determinate progress
-						t.UpdateMessage(statusColor.Sprintf("%s %d ✓", fn, resp.StatusCode))
-						t.MarkAsDone()
-					}(fileName, tracker)
-				}
-			}
-
-			wg.Wait()
+					result = runTest(step, tracker)
+				}
+				result.Retried = retried
+				result.Duration = time.Since(start)
+				record(i, result)
+				return result.Outcome == util.OutcomePassed
+			}, func(i int, reason string) {
+				trackers[i].Total = 100
+				trackers[i].UpdateMessage(text.FgHiBlack.Sprintf("%s skipped: %s", plan.Steps[i].Name, reason))
+				trackers[i].MarkAsDone()
+				record(i, util.TestResult{Name: plan.Steps[i].Name, Outcome: util.OutcomeSkipped, Message: reason})
+			})
 
 			// Wait for progress to finish rendering
 			for pw.IsRenderInProgress() {
@@ -186,11 +336,115 @@ func TestCmd() *cobra.Command {
 				}
 			}
 
+			report.Duration = time.Since(report.StartedAt)
+			if updateBaselines {
+				reviewBaselines(pendingBaselines, yes)
+			}
+			if reporter != "" {
+				// Redact with the variables after the run too, which hold the tokens of logins during it
+				final, err := util.LoadEnv()
+				if err != nil {
+					fmt.Printf("Error loading env: %v\n", err)
+					os.Exit(1)
+				}
+				redactor := util.NewRedactor(redact, env.Resolved, final.Resolved)
+				if err := writeTestReport(reporter, reportFile, redactor.Report(report)); err != nil {
+					fmt.Printf("Error writing report: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			var flaky []string
+			for _, result := range report.Results {
+				if result.Flaky() {
+					flaky = append(flaky, fmt.Sprintf("  - %s (passed on attempt %d)", result.Name, len(result.Retried)+1))
+				}
+			}
+			if len(flaky) > 0 {
+				fmt.Printf("\nFlaky, passed only on retry:\n%s\n", strings.Join(flaky, "\n"))
+			}
+
 			if failed {
 				fmt.Println("\nOne or more tests failed")
 				os.Exit(1)
 			}
+			if len(flaky) > 0 && failOnFlaky {
+				fmt.Println("\nFailing because of flaky tests (--fail-on-flaky)")
+				os.Exit(1)
+			}
 			fmt.Println("\nAll tests passed")
 		},
 	}
+	cmd.Flags().BoolVar(&lenient, "lenient", false, "Send requests even if some placeholders are unresolved")
+	cmd.Flags().BoolVar(&updateBaselines, "update-baselines", false, "After the run, show how each response changes the baseline of its status and ask to accept it")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Accept the --update-baselines changes without asking for confirmation")
+	cmd.Flags().StringArrayVar(&filter.Tags, "tag", nil, "Only run requests with this tag (repeatable)")
+	cmd.Flags().StringArrayVar(&filter.Exclude, "exclude", nil, "Skip requests matching this path glob (repeatable)")
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "c", 0, "Run at most this many requests at a time (0 for no limit)")
+	cmd.Flags().BoolVar(&failOnFlaky, "fail-on-flaky", false, "Exit with an error if a request passed only after retries")
+	cmd.Flags().StringVar(&reporter, "reporter", "", "Write a report of the run: junit, json, tap or html (junit if only --report-file is set)")
+	cmd.Flags().StringVar(&reportFile, "report-file", "", "Write the report to this file (required with --reporter)")
+	cmd.Flags().StringArrayVar(&redact, "redact", nil, "Also hide headers, properties and query parameters with this name in the report (repeatable)")
+	cmd.RegisterFlagCompletionFunc("reporter", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return util.Reporters(), cobra.ShellCompDirectiveNoFileComp
+	})
+	return cmd
+}
+
+// pendingBaseline is a baseline to review once the run is done, so prompts don't mix with the progress view.
+type pendingBaseline struct {
+	name   string
+	path   string
+	status int
+}
+
+// reviewBaselines proposes each pending baseline from the recorded responses and writes the
+// changed ones once accepted, like 'lpost baseline approve'.
+func reviewBaselines(pending []pendingBaseline, yes bool) {
+	slices.SortFunc(pending, func(a, b pendingBaseline) int {
+		return cmp.Or(strings.Compare(a.name, b.name), cmp.Compare(a.status, b.status))
+	})
+	var updated, unchanged int
+	for i, p := range pending {
+		// Responses of a request that shared a status, such as its 2xx ones, share the baseline
+		if i > 0 && pending[i-1].path == p.path && util.StatusSchemaPath(p.path, pending[i-1].status) == util.StatusSchemaPath(p.path, p.status) {
+			continue
+		}
+		proposal, err := util.ProposeBaseline(p.path, p.status)
+		if err != nil {
+			fmt.Printf("Error inferring the baseline of %s: %v\n", p.name, err)
+			os.Exit(1)
+		}
+		if len(proposal.Diff) == 0 {
+			unchanged++
+			continue
+		}
+		fmt.Println()
+		if err := acceptBaseline(proposal, yes); errors.Is(err, errBaselineDeclined) {
+			fmt.Println("Baseline not changed")
+			unchanged++
+		} else if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		} else {
+			updated++
+		}
+	}
+	fmt.Printf("\nUpdated %d baselines, %d unchanged\n", updated, unchanged)
+}
+
+// writeTestReport writes the report of a test run to file, creating its directory.
+func writeTestReport(reporter, file string, report util.TestReport) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("error creating %s: %v", filepath.Dir(file), err)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := util.WriteReport(f, reporter, report); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
@@ -3,19 +3,19 @@ module github.com/moshe5745/localpost
 go 1.24.1
 
 require (
+	github.com/bombsimon/jtd-infer-go v0.1.0
 	github.com/fatih/color v1.18.0
 	github.com/jedib0t/go-pretty/v6 v6.6.7
+	github.com/jsontypedef/json-typedef-go v0.0.0-20200503043955-4280071bd745
+	github.com/manifoldco/promptui v0.9.0
 	github.com/spf13/cobra v1.9.1
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/bombsimon/jtd-infer-go v0.1.0 // indirect
 	github.com/briandowns/spinner v1.23.2 // indirect
 	github.com/chzyer/readline v0.0.0-20180603132655-2972be24d48e // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/jsontypedef/json-typedef-go v0.0.0-20200503043955-4280071bd745 // indirect
-	github.com/manifoldco/promptui v0.9.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/fatih/color"
 
@@ -36,19 +37,30 @@ func main() {
 				return fmt.Errorf("%s\nMake sure you running in the right directory or run 'lpost init' to init localpost.", red(err))
 			}
 
-			// Handle --env flag
-			flag := cmd.PersistentFlags().Lookup("env")
-			if flag != nil {
-				if flagEnv := flag.Value.String(); flagEnv != "" {
-					if err := util.SetEnv(flagEnv); err != nil {
-						return fmt.Errorf("error setting environment: %v", err)
+			// Handle --env flag: applies to this invocation only, config.yaml is left untouched
+			if flagEnv, _ := cmd.Flags().GetString("env"); flagEnv != "" {
+				util.UseEnv(flagEnv)
+			}
+
+			// Handle --var flags
+			flagVars, _ := cmd.Flags().GetStringArray("var")
+			if len(flagVars) > 0 {
+				vars := make(map[string]string, len(flagVars))
+				for _, kv := range flagVars {
+					key, value, ok := strings.Cut(kv, "=")
+					if !ok || key == "" {
+						cmd.SilenceUsage = true
+						return fmt.Errorf("invalid --var %q, expected KEY=VALUE", kv)
 					}
+					vars[key] = value
 				}
+				util.SetVarOverrides(vars)
 			}
 			return nil
 		},
 	}
-	rootCmd.PersistentFlags().StringP("env", "e", "", "Environment to use (e.g., dev, prod); defaults to .localpost-config or 'dev'")
+	rootCmd.PersistentFlags().StringP("env", "e", "", "Environment to use for this command only (e.g., dev, prod); defaults to 'env' in config.yaml")
+	rootCmd.PersistentFlags().StringArray("var", nil, "Override a variable for this command only (KEY=VALUE, repeatable)")
 
 	rootCmd.AddGroup(&cobra.Group{ID: "requests", Title: "RequestDefinition Commands"})
 	rootCmd.AddGroup(&cobra.Group{ID: "environment", Title: "Environment Commands"})
@@ -58,9 +70,13 @@ func main() {
 	rootCmd.AddCommand(commands.RequestCmd())
 	rootCmd.AddCommand(commands.ListCmd())
 	rootCmd.AddCommand(commands.TestCmd())
+	rootCmd.AddCommand(commands.BaselineCmd())
+	rootCmd.AddCommand(commands.SchemaCmd())
 	rootCmd.AddCommand(commands.SetEnvCmd())
 	rootCmd.AddCommand(commands.SetEnvVarCmd())
 	rootCmd.AddCommand(commands.ShowEnvCmd())
+	rootCmd.AddCommand(commands.SessionCmd())
+	rootCmd.AddCommand(commands.CookiesCmd())
 	rootCmd.AddCommand(commands.CompletionCmd())
 
 	if err := rootCmd.Execute(); err != nil {
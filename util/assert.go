@@ -0,0 +1,308 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UnmarshalYAML allows `status: 200` as well as `status: [200, 201]`.
+func (s *StatusList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var code int
+		if err := value.Decode(&code); err != nil {
+			return fmt.Errorf("invalid status code %q", value.Value)
+		}
+		*s = StatusList{code}
+		return nil
+	}
+	var codes []int
+	if err := value.Decode(&codes); err != nil {
+		return err
+	}
+	*s = codes
+	return nil
+}
+
+// UnmarshalYAML allows `Content-Type: application/json` as shorthand for equals.
+func (h *HeaderExpect) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		h.Equals = value.Value
+		return nil
+	}
+	type plain HeaderExpect
+	return value.Decode((*plain)(h))
+}
+
+// UnmarshalYAML allows `$.id: 42` as shorthand for equals. A mapping without any
+// of the equals/matches/exists keys is treated as an expected object.
+func (b *BodyExpect) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode || !hasAnyKey(value, "equals", "matches", "exists") {
+		b.hasEquals = true
+		return value.Decode(&b.Equals)
+	}
+	type plain BodyExpect
+	if err := value.Decode((*plain)(b)); err != nil {
+		return err
+	}
+	b.hasEquals = hasAnyKey(value, "equals")
+	return nil
+}
+
+// UnmarshalYAML decodes `$.deleted_at: null` as an expected null. yaml.v3 does not call
+// BodyExpect.UnmarshalYAML for null values, so they are handled here.
+func (b *BodyExpects) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: body expectations must be a mapping of paths", value.Line)
+	}
+	*b = make(BodyExpects, len(value.Content)/2)
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		var expect BodyExpect
+		if node := value.Content[i+1]; node.Tag == "!!null" {
+			expect.hasEquals = true
+		} else if err := node.Decode(&expect); err != nil {
+			return err
+		}
+		(*b)[value.Content[i].Value] = expect
+	}
+	return nil
+}
+
+func hasAnyKey(node *yaml.Node, keys ...string) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if slices.Contains(keys, node.Content[i].Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateExpectations runs every assertion in expect against resp and returns their results.
+// Results are ordered: status, headers, body, timing.
+func evaluateExpectations(expect *Expect, resp Response) []AssertionResult {
+	if expect == nil {
+		return nil
+	}
+	var results []AssertionResult
+
+	if len(expect.Status) > 0 {
+		result := AssertionResult{Name: fmt.Sprintf("status in %v", []int(expect.Status))}
+		if slices.Contains(expect.Status, resp.StatusCode) {
+			result.Passed = true
+		} else {
+			result.Message = fmt.Sprintf("got %d", resp.StatusCode)
+		}
+		results = append(results, result)
+	}
+
+	headerNames := make([]string, 0, len(expect.Headers))
+	for name := range expect.Headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	for _, name := range headerNames {
+		results = append(results, checkHeader(name, expect.Headers[name], http.Header(resp.RespHeaders))...)
+	}
+
+	if len(expect.Body) > 0 {
+		doc, bodyErr := decodeJSON(resp.RespBody)
+		paths := make([]string, 0, len(expect.Body))
+		for path := range expect.Body {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if bodyErr != nil {
+				results = append(results, AssertionResult{
+					Name:    fmt.Sprintf("body %s", path),
+					Message: "response body is not valid JSON",
+				})
+				continue
+			}
+			results = append(results, checkBody(path, expect.Body[path], doc)...)
+		}
+	}
+
+	if expect.MaxTime > 0 {
+		result := AssertionResult{Name: fmt.Sprintf("time <= %dms", expect.MaxTime)}
+		if resp.Duration.Milliseconds() <= int64(expect.MaxTime) {
+			result.Passed = true
+		} else {
+			result.Message = fmt.Sprintf("took %dms", resp.Duration.Milliseconds())
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func checkHeader(name string, expect HeaderExpect, headers http.Header) []AssertionResult {
+	var results []AssertionResult
+	values := headers.Values(name)
+	actual := ""
+	if len(values) > 0 {
+		actual = values[0]
+	}
+
+	if expect.Equals != "" {
+		result := AssertionResult{Name: fmt.Sprintf("header %s equals %q", name, expect.Equals)}
+		switch {
+		case len(values) == 0:
+			result.Message = "header not present"
+		case actual != expect.Equals:
+			result.Message = fmt.Sprintf("got %q", actual)
+		default:
+			result.Passed = true
+		}
+		results = append(results, result)
+	}
+
+	if expect.Matches != "" {
+		result := AssertionResult{Name: fmt.Sprintf("header %s matches /%s/", name, expect.Matches)}
+		re, err := regexp.Compile(expect.Matches)
+		switch {
+		case err != nil:
+			result.Message = fmt.Sprintf("invalid regex: %v", err)
+		case len(values) == 0:
+			result.Message = "header not present"
+		case !re.MatchString(actual):
+			result.Message = fmt.Sprintf("got %q", actual)
+		default:
+			result.Passed = true
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func checkBody(path string, expect BodyExpect, doc interface{}) []AssertionResult {
+	var results []AssertionResult
+	value, found, err := lookupJSONPath(doc, path)
+	if err != nil {
+		return []AssertionResult{{Name: fmt.Sprintf("body %s", path), Message: err.Error()}}
+	}
+
+	if expect.Exists != nil {
+		result := AssertionResult{Name: fmt.Sprintf("body %s exists=%t", path, *expect.Exists)}
+		if found == *expect.Exists {
+			result.Passed = true
+		} else if found {
+			result.Message = "path is present"
+		} else {
+			result.Message = "path not found"
+		}
+		results = append(results, result)
+	}
+
+	if expect.hasEquals {
+		want := normalizeJSON(expect.Equals)
+		result := AssertionResult{Name: fmt.Sprintf("body %s equals %s", path, compactJSON(want))}
+		switch {
+		case !found:
+			result.Message = "path not found"
+		case !jsonEqual(value, want):
+			result.Message = fmt.Sprintf("got %s", compactJSON(value))
+		default:
+			result.Passed = true
+		}
+		results = append(results, result)
+	}
+
+	if expect.Matches != "" {
+		result := AssertionResult{Name: fmt.Sprintf("body %s matches /%s/", path, expect.Matches)}
+		re, err := regexp.Compile(expect.Matches)
+		switch {
+		case err != nil:
+			result.Message = fmt.Sprintf("invalid regex: %v", err)
+		case !found:
+			result.Message = "path not found"
+		case !re.MatchString(stringifyJSONValue(value)):
+			result.Message = fmt.Sprintf("got %s", compactJSON(value))
+		default:
+			result.Passed = true
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// normalizeJSON round-trips a YAML-decoded value through JSON so it compares equal
+// to values decoded by decodeJSON (e.g. int -> json.Number).
+func normalizeJSON(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	out, err := decodeJSON(string(data))
+	if err != nil {
+		return v
+	}
+	return out
+}
+
+// jsonEqual compares decoded JSON values. Numbers are compared by value, so 1.0 equals 1
+// and large integers are compared exactly.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okA := new(big.Rat).SetString(a.String())
+		y, okB := new(big.Rat).SetString(b.String())
+		if !okA || !okB {
+			return a == b
+		}
+		return x.Cmp(y) == 0
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// stringifyJSONValue renders strings without quotes and everything else as compact JSON.
+func stringifyJSONValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return compactJSON(v)
+}
@@ -0,0 +1,108 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestEvaluateExpectations(t *testing.T) {
+	var reqDef RequestDefinition
+	def := `
+expect:
+  status: 200
+  headers:
+    Content-Type: application/json
+    X-Request-Id:
+      matches: "^[a-f0-9]+$"
+  body:
+    $.data.items[0].id: 7
+    $.data.name:
+      matches: "^ali"
+    $.data.missing:
+      exists: false
+  max-time: 50
+`
+	if err := yaml.Unmarshal([]byte(def), &reqDef); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	resp := Response{
+		StatusCode: 500,
+		RespHeaders: map[string][]string{
+			"Content-Type": {"application/json"},
+			"X-Request-Id": {"abc123"},
+		},
+		RespBody: `{"data":{"name":"alice","items":[{"id":8}]}}`,
+		Duration: 10 * time.Millisecond,
+	}
+
+	resp.Assertions = evaluateExpectations(reqDef.Expect, resp)
+	if len(resp.Assertions) != 7 {
+		t.Fatalf("expected 7 results, got %d: %+v", len(resp.Assertions), resp.Assertions)
+	}
+
+	failed := map[string]bool{}
+	for _, r := range resp.FailedAssertions() {
+		failed[r.Name] = true
+	}
+	if !failed["status in [200]"] {
+		t.Errorf("expected status assertion to fail")
+	}
+	if !failed["body $.data.items[0].id equals 7"] {
+		t.Errorf("expected body equals assertion to fail")
+	}
+	if len(failed) != 2 {
+		t.Errorf("expected exactly 2 failures, got %v", failed)
+	}
+}
+
+func TestBodyEqualsLargeNumbers(t *testing.T) {
+	var expect Expect
+	def := `
+body:
+  id: 1234567890123456789
+  price: 1
+  ids: [1234567890123456789]
+  next_id: 1234567890123456788
+`
+	if err := yaml.Unmarshal([]byte(def), &expect); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	resp := Response{RespBody: `{"id":1234567890123456789,"price":1.0,"ids":[1234567890123456789],"next_id":1234567890123456789}`}
+
+	failed := map[string]string{}
+	for _, r := range evaluateExpectations(&expect, resp) {
+		if !r.Passed {
+			failed[r.Name] = r.Message
+		}
+	}
+	// Both IDs round to the same float64, so only exact comparison catches the mismatch
+	if len(failed) != 1 || failed["body next_id equals 1234567890123456788"] != "got 1234567890123456789" {
+		t.Errorf("failed assertions = %v, expected only next_id", failed)
+	}
+}
+
+func TestBodyEqualsNull(t *testing.T) {
+	var expect Expect
+	def := `
+body:
+  x: null
+  y:
+    equals: null
+  z: null
+`
+	if err := yaml.Unmarshal([]byte(def), &expect); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	results := evaluateExpectations(&expect, Response{RespBody: `{"x":1,"y":2,"z":null}`})
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d: %+v", len(results), results)
+	}
+	for _, r := range results {
+		if passed := r.Name == "body z equals null"; r.Passed != passed {
+			t.Errorf("%s: passed = %t, message %q", r.Name, r.Passed, r.Message)
+		}
+	}
+}
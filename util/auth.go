@@ -0,0 +1,188 @@
+package util
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Supported auth types.
+const (
+	AuthNone   = "none"
+	AuthBasic  = "basic"
+	AuthBearer = "bearer"
+	AuthAPIKey = "api-key"
+	AuthDigest = "digest"
+)
+
+// UnmarshalYAML allows `auth: none` to disable an environment's default auth.
+func (a *Auth) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		a.Type = value.Value
+		return nil
+	}
+	type plain Auth
+	return value.Decode((*plain)(a))
+}
+
+// validate checks that the fields required by the auth type are set.
+func (a *Auth) validate() error {
+	switch a.Type {
+	case AuthNone:
+	case AuthBasic, AuthDigest:
+		if a.Username == "" {
+			return fmt.Errorf("%s auth requires username", a.Type)
+		}
+	case AuthBearer:
+		if a.Token == "" {
+			return fmt.Errorf("bearer auth requires token")
+		}
+	case AuthAPIKey:
+		if a.Key == "" {
+			return fmt.Errorf("api-key auth requires key")
+		}
+		if a.In != "" && a.In != "header" && a.In != "query" {
+			return fmt.Errorf("api-key auth 'in' must be header or query, got %q", a.In)
+		}
+	default:
+		return fmt.Errorf("unsupported auth type %q (expected basic, bearer, api-key, digest or none)", a.Type)
+	}
+	return nil
+}
+
+// applyAuth adds credentials to req. Digest auth needs a server challenge first, see digestAuthorization.
+// An Authorization header set explicitly in the request definition is never overridden.
+func applyAuth(req *http.Request, auth *Auth) error {
+	if auth == nil {
+		return nil
+	}
+	if err := auth.validate(); err != nil {
+		return err
+	}
+	switch auth.Type {
+	case AuthBasic:
+		if req.Header.Get("Authorization") == "" {
+			req.SetBasicAuth(auth.Username, auth.Password)
+		}
+	case AuthBearer:
+		if req.Header.Get("Authorization") == "" {
+			req.Header.Set("Authorization", "Bearer "+auth.Token)
+		}
+	case AuthAPIKey:
+		if auth.In == "query" {
+			q := req.URL.RawQuery
+			if q != "" {
+				q += "&"
+			}
+			req.URL.RawQuery = q + url.QueryEscape(auth.Key) + "=" + url.QueryEscape(auth.Value)
+		} else if req.Header.Get(auth.Key) == "" {
+			req.Header.Set(auth.Key, auth.Value)
+		}
+	}
+	return nil
+}
+
+// digestAuthorization builds the Authorization header answering a WWW-Authenticate Digest
+// challenge (RFC 7616), supporting MD5 and SHA-256 with qop=auth or no qop.
+func digestAuthorization(challenge string, auth *Auth, req *http.Request, cnonce string) (string, error) {
+	scheme, params, ok := strings.Cut(challenge, " ")
+	if !ok || !strings.EqualFold(scheme, "Digest") {
+		return "", fmt.Errorf("not a digest challenge: %q", challenge)
+	}
+	c := parseAuthParams(params)
+
+	var newHash func() hash.Hash
+	algorithm := c["algorithm"]
+	switch strings.ToUpper(algorithm) {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+	h := func(s string) string {
+		hh := newHash()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	uri := req.URL.RequestURI()
+	ha1 := h(auth.Username + ":" + c["realm"] + ":" + auth.Password)
+	ha2 := h(req.Method + ":" + uri)
+
+	qop := ""
+	for _, q := range strings.Split(c["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	if c["qop"] != "" && qop == "" {
+		return "", fmt.Errorf("unsupported digest qop %q", c["qop"])
+	}
+
+	const nc = "00000001"
+	var response string
+	if qop == "" {
+		response = h(ha1 + ":" + c["nonce"] + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + c["nonce"] + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+
+	parts := []string{
+		fmt.Sprintf(`username="%s"`, auth.Username),
+		fmt.Sprintf(`realm="%s"`, c["realm"]),
+		fmt.Sprintf(`nonce="%s"`, c["nonce"]),
+		fmt.Sprintf(`uri="%s"`, uri),
+		fmt.Sprintf(`response="%s"`, response),
+	}
+	if algorithm != "" {
+		parts = append(parts, "algorithm="+algorithm)
+	}
+	if qop != "" {
+		parts = append(parts, "qop="+qop, "nc="+nc, fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+	if opaque, ok := c["opaque"]; ok {
+		parts = append(parts, fmt.Sprintf(`opaque="%s"`, opaque))
+	}
+	return "Digest " + strings.Join(parts, ", "), nil
+}
+
+// parseAuthParams parses comma separated key=value or key="value" pairs from a challenge.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.IndexByte(s, '=')
+		if eq == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end == -1 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end == -1 {
+				value, s = s, ""
+			} else {
+				value, s = s[:end], s[end:]
+			}
+		}
+		params[key] = strings.TrimSpace(value)
+	}
+	return params
+}
@@ -0,0 +1,74 @@
+package util
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestApplyAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		auth     *Auth
+		header   string
+		expected string
+		query    string
+	}{
+		{"basic", &Auth{Type: AuthBasic, Username: "user", Password: "pass"}, "Authorization", "Basic dXNlcjpwYXNz", "a=1"},
+		{"bearer", &Auth{Type: AuthBearer, Token: "abc"}, "Authorization", "Bearer abc", "a=1"},
+		{"api-key header", &Auth{Type: AuthAPIKey, Key: "X-API-Key", Value: "k1"}, "X-API-Key", "k1", "a=1"},
+		{"api-key query", &Auth{Type: AuthAPIKey, Key: "api_key", Value: "k 1", In: "query"}, "Authorization", "", "a=1&api_key=k+1"},
+		{"none", &Auth{Type: AuthNone}, "Authorization", "", "a=1"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "http://example.com/items?a=1", nil)
+		if err := applyAuth(req, tt.auth); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got := req.Header.Get(tt.header); got != tt.expected {
+			t.Errorf("%s: %s = %q, expected %q", tt.name, tt.header, got, tt.expected)
+		}
+		if req.URL.RawQuery != tt.query {
+			t.Errorf("%s: query = %q, expected %q", tt.name, req.URL.RawQuery, tt.query)
+		}
+	}
+
+	// An explicit Authorization header wins over the configured auth
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("Authorization", "Bearer explicit")
+	applyAuth(req, &Auth{Type: AuthBearer, Token: "abc"})
+	if got := req.Header.Get("Authorization"); got != "Bearer explicit" {
+		t.Errorf("explicit header overridden: %q", got)
+	}
+
+	if err := applyAuth(req, &Auth{Type: "oauth"}); err == nil {
+		t.Errorf("expected error for unsupported auth type")
+	}
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	// Example from RFC 2617 section 3.5
+	challenge := `Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`
+	req, _ := http.NewRequest("GET", "http://www.nowhere.org/dir/index.html", nil)
+	auth := &Auth{Type: AuthDigest, Username: "Mufasa", Password: "Circle Of Life"}
+
+	got, err := digestAuthorization(challenge, auth, req, "0a4f113b")
+	if err != nil {
+		t.Fatalf("digestAuthorization error: %v", err)
+	}
+	for _, part := range []string{
+		`username="Mufasa"`,
+		`uri="/dir/index.html"`,
+		`response="6629fae49393a05397450978507c4ef1"`,
+		`qop=auth`,
+		`nc=00000001`,
+		`cnonce="0a4f113b"`,
+		`opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+	} {
+		if !strings.Contains(got, part) {
+			t.Errorf("authorization %q missing %s", got, part)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jtdinfer "github.com/bombsimon/jtd-infer-go"
+	"github.com/fatih/color"
+)
+
+// defaultSampleLimit is how many recorded responses of a request are kept when schema.samples is not set.
+const defaultSampleLimit = 20
+
+// sample is a recorded response body, stored one JSON object per line.
+type sample struct {
+	Env        string          `json:"env"`
+	RecordedAt time.Time       `json:"recorded_at"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// sampleBase returns the samples path of a request file without extension.
+func sampleBase(filePath string) string {
+	rel, err := filepath.Rel(RequestsDir, filePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(filePath)
+	}
+	return filepath.Join(SamplesDir, strings.TrimSuffix(rel, ".yaml"))
+}
+
+// samplePath returns where the recorded responses of a request file with the given status are
+// kept. Like baselines, all 2xx responses share one sample set and other statuses have their own.
+func samplePath(filePath string, status int) string {
+	if isSuccessStatus(status) {
+		return sampleBase(filePath) + ".jsonl"
+	}
+	return sampleBase(filePath) + "." + strconv.Itoa(status) + ".jsonl"
+}
+
+// HasJSONBody reports whether the response has a JSON body, the kind baselines are inferred from.
+func (r Response) HasJSONBody() bool {
+	if strings.TrimSpace(r.RespBody) == "" {
+		return false
+	}
+	return json.Valid([]byte(r.RespBody))
+}
+
+// recordSample adds a JSON response to the samples of a request for its status, keeping the
+// newest schema.samples of them. A body equal to a stored one replaces it instead of
+// being stored twice. Baselines are inferred from all samples, across runs and envs.
+// Secrets such as the tokens of a login response are redacted before they are stored.
+func recordSample(filePath string, resp Response, hints *SchemaHints) error {
+	if !resp.HasJSONBody() {
+		return nil
+	}
+	envName := ""
+	var vars map[string]string
+	if env, err := LoadEnv(); err == nil {
+		envName, vars = env.Name, env.Resolved
+	}
+	body, err := NewRedactor(nil, vars).Sample([]byte(resp.RespBody))
+	if err != nil {
+		return err
+	}
+
+	samples, err := loadSamples(filePath, resp.StatusCode)
+	if err != nil {
+		return err
+	}
+	samples = slices.DeleteFunc(samples, func(s sample) bool { return bytes.Equal(s.Body, body) })
+	samples = append(samples, sample{Env: envName, RecordedAt: time.Now().UTC(), Body: body})
+	if limit := hints.sampleLimit(); len(samples) > limit {
+		samples = samples[len(samples)-limit:]
+	}
+
+	var out bytes.Buffer
+	for _, s := range samples {
+		line, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		out.Write(append(line, '\n'))
+	}
+	if err := ignoreSamples(); err != nil {
+		return err
+	}
+	path := samplePath(filePath, resp.StatusCode)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating %s: %v", filepath.Dir(path), err)
+	}
+	return os.WriteFile(path, out.Bytes(), 0644)
+}
+
+// ignoreSamples creates the samples directory with a .gitignore that ignores everything in it,
+// so recorded responses are kept out of git even when lpost/.gitignore predates them.
+func ignoreSamples() error {
+	path := filepath.Join(SamplesDir, ".gitignore")
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(SamplesDir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %v", SamplesDir, err)
+	}
+	if err := os.WriteFile(path, []byte("*\n"), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// loadSamples returns the recorded samples of a request file for a status, oldest first.
+func loadSamples(filePath string, status int) ([]sample, error) {
+	path := samplePath(filePath, status)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var samples []sample
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var s sample
+		if err := json.Unmarshal(line, &s); err != nil {
+			return nil, fmt.Errorf("error parsing %s line %d: %v", path, i+1, err)
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// IgnoreSamplesDir adds the samples directory to lpost/.gitignore of projects created before it
+// existed. It reports whether the entry was added.
+func IgnoreSamplesDir() (bool, error) {
+	data, err := os.ReadFile(GitignoreFilePath)
+	if err != nil {
+		return false, err
+	}
+	entry := SamplesIgnoreEntry()
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == entry {
+			return false, nil
+		}
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	if err := os.WriteFile(GitignoreFilePath, append(data, entry+"\n"...), 0644); err != nil {
+		return false, fmt.Errorf("error writing %s: %v", GitignoreFilePath, err)
+	}
+	return true, nil
+}
+
+// SamplesIgnoreEntry returns the lpost/.gitignore line that keeps recorded samples out of git.
+func SamplesIgnoreEntry() string {
+	return strings.TrimPrefix(SamplesDir, LocalpostDir+"/") + "/"
+}
+
+// ErrNoSamples is returned when a baseline is inferred for a request without recorded responses.
+var ErrNoSamples = errors.New("no recorded response")
+
+// SampleSet describes the samples a baseline is inferred from.
+type SampleSet struct {
+	Count int
+	Envs  []string // Environments the samples were recorded in, sorted
+}
+
+func (s SampleSet) String() string {
+	noun := "samples"
+	if s.Count == 1 {
+		noun = "sample"
+	}
+	if len(s.Envs) == 0 || len(s.Envs) == 1 && s.Envs[0] == "" {
+		return fmt.Sprintf("%d %s", s.Count, noun)
+	}
+	return fmt.Sprintf("%d %s from %s", s.Count, noun, strings.Join(s.Envs, ", "))
+}
+
+// SampleStatuses returns the statuses a request file has recorded responses for, with
+// 200 standing for all 2xx responses.
+func SampleStatuses(filePath string) ([]int, error) {
+	base := sampleBase(filePath)
+	matches, err := filepath.Glob(base + "*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	var statuses []int
+	for _, match := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(match, base), ".jsonl")
+		if suffix == "" {
+			statuses = append(statuses, 200)
+		} else if code, ok := strings.CutPrefix(suffix, "."); ok {
+			if status, err := strconv.Atoi(code); err == nil {
+				statuses = append(statuses, status)
+			}
+		}
+	}
+	sort.Ints(statuses)
+	return statuses, nil
+}
+
+// InferFromSamples infers the baseline schema of a request file for a status from all of its
+// recorded samples, in the baseline's format and using the hints in the request's schema block.
+func InferFromSamples(filePath string, status int) ([]byte, SampleSet, error) {
+	samples, err := loadSamples(filePath, status)
+	if err != nil {
+		return nil, SampleSet{}, err
+	}
+	if len(samples) == 0 {
+		if isSuccessStatus(status) {
+			return nil, SampleSet{}, fmt.Errorf("%w for %s, run it with lpost request first", ErrNoSamples, filePath)
+		}
+		return nil, SampleSet{}, fmt.Errorf("%w with status %d for %s, run it with lpost request first", ErrNoSamples, status, filePath)
+	}
+	hints, err := readSchemaHints(filePath)
+	if err != nil {
+		return nil, SampleSet{}, err
+	}
+
+	set := SampleSet{Count: len(samples)}
+	bodies := make([]string, len(samples))
+	for i, s := range samples {
+		bodies[i] = string(s.Body)
+		if !slices.Contains(set.Envs, s.Env) {
+			set.Envs = append(set.Envs, s.Env)
+		}
+	}
+	sort.Strings(set.Envs)
+
+	if _, err := schemaFormatNamed(hints.Format); err != nil {
+		return nil, SampleSet{}, fmt.Errorf("%s: %v", filePath, err)
+	}
+	schema, err := baselineFormat(filePath, status).Infer(bodies, hints)
+	return schema, set, err
+}
+
+// InferBaseline infers a JTD schema from JSON response bodies, formatted as stored on disk.
+// Properties missing from some bodies become optional, and null makes a property nullable.
+func InferBaseline(bodies []string, hints SchemaHints) ([]byte, error) {
+	schema, err := inferJTD(bodies, hints)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func inferJTD(bodies []string, hints SchemaHints) (jtdinfer.Schema, error) {
+	for _, body := range bodies {
+		if !json.Valid([]byte(body)) {
+			return jtdinfer.Schema{}, fmt.Errorf("response body is not valid JSON")
+		}
+	}
+	schema := jtdinfer.InferStrings(bodies, hints.inferHints()).IntoSchema()
+	refineSchema(&schema, hints)
+	return schema, nil
+}
+
+// ReadBaseline returns the stored baseline schema of a request file for a status, or nil if there is none.
+func ReadBaseline(filePath string, status int) ([]byte, error) {
+	data, err := os.ReadFile(StatusSchemaPath(filePath, status))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// WriteBaseline stores schema as the baseline of a request file for a status.
+func WriteBaseline(filePath string, status int, schema []byte) error {
+	path := StatusSchemaPath(filePath, status)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, schema, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// BaselineDiff lists the changes from oldSchema to newSchema as "+ path: value",
+// "- path: value" and "~ path: old -> new" lines. It is empty when they are equal.
+// A nil oldSchema is a missing baseline, reported as a single addition.
+func BaselineDiff(oldSchema, newSchema []byte) ([]string, error) {
+	var oldDoc, newDoc interface{}
+	if err := json.Unmarshal(newSchema, &newDoc); err != nil {
+		return nil, fmt.Errorf("invalid new schema: %v", err)
+	}
+	if oldSchema == nil {
+		return []string{"+ (new baseline)"}, nil
+	}
+	if err := json.Unmarshal(oldSchema, &oldDoc); err != nil {
+		return nil, fmt.Errorf("invalid baseline schema: %v", err)
+	}
+	var lines []string
+	diffJSON("", oldDoc, newDoc, &lines)
+	return lines, nil
+}
+
+func diffJSON(path string, oldValue, newValue interface{}, lines *[]string) {
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if !oldIsMap || !newIsMap {
+		if !reflect.DeepEqual(oldValue, newValue) {
+			*lines = append(*lines, fmt.Sprintf("~ %s: %s -> %s", displayPath(path), compactJSON(oldValue), compactJSON(newValue)))
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(oldMap)+len(newMap))
+	for key := range oldMap {
+		keys = append(keys, key)
+	}
+	for key := range newMap {
+		if _, ok := oldMap[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		child := key
+		if path != "" {
+			child = path + "." + key
+		}
+		oldChild, inOld := oldMap[key]
+		newChild, inNew := newMap[key]
+		switch {
+		case !inNew:
+			*lines = append(*lines, fmt.Sprintf("- %s: %s", child, compactJSON(oldChild)))
+		case !inOld:
+			*lines = append(*lines, fmt.Sprintf("+ %s: %s", child, compactJSON(newChild)))
+		default:
+			diffJSON(child, oldChild, newChild, lines)
+		}
+	}
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
+
+// BaselineProposal is a schema inferred from the recorded responses of a request file for a
+// status, with its diff against the current baseline. Nothing is written until it is accepted.
+type BaselineProposal struct {
+	FilePath string
+	Status   int
+	Schema   []byte
+	Diff     []string // Empty when the baseline is up to date
+	Samples  SampleSet
+}
+
+// SchemaPath returns the baseline file the proposal would be written to.
+func (p BaselineProposal) SchemaPath() string {
+	return StatusSchemaPath(p.FilePath, p.Status)
+}
+
+// ProposeBaseline infers a schema from the recorded samples of a request file for a status and
+// compares it with the current baseline.
+func ProposeBaseline(filePath string, status int) (BaselineProposal, error) {
+	schema, samples, err := InferFromSamples(filePath, status)
+	if err != nil {
+		return BaselineProposal{}, err
+	}
+	current, err := ReadBaseline(filePath, status)
+	if err != nil {
+		return BaselineProposal{}, err
+	}
+	diff, err := BaselineDiff(current, schema)
+	if err != nil {
+		return BaselineProposal{}, err
+	}
+	return BaselineProposal{FilePath: filePath, Status: status, Schema: schema, Diff: diff, Samples: samples}, nil
+}
+
+// PrintBaselineDiff prints diff lines colored by kind of change.
+func PrintBaselineDiff(w io.Writer, diff []string) {
+	for _, line := range diff {
+		switch line[0] {
+		case '+':
+			fmt.Fprintln(w, color.GreenString("    %s", line))
+		case '-':
+			fmt.Fprintln(w, color.RedString("    %s", line))
+		default:
+			fmt.Fprintln(w, color.YellowString("    %s", line))
+		}
+	}
+}
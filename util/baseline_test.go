@@ -0,0 +1,136 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBaselineDiff(t *testing.T) {
+	oldSchema := []byte(`{"properties":{"id":{"type":"uint8"},"name":{"type":"string"},"legacy":{"type":"string"}}}`)
+	newSchema := []byte(`{"properties":{"id":{"type":"uint16"},"name":{"type":"string"},"email":{"type":"string"}}}`)
+
+	diff, err := BaselineDiff(oldSchema, newSchema)
+	if err != nil {
+		t.Fatalf("BaselineDiff error: %v", err)
+	}
+	expected := []string{
+		`+ properties.email: {"type":"string"}`,
+		`~ properties.id.type: "uint8" -> "uint16"`,
+		`- properties.legacy: {"type":"string"}`,
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("BaselineDiff = %q, expected %q", diff, expected)
+	}
+
+	if diff, _ := BaselineDiff(newSchema, newSchema); len(diff) != 0 {
+		t.Errorf("expected no diff for equal schemas, got %q", diff)
+	}
+}
+
+// acceptProposal proposes the baseline of filePath for status and writes it, returning the diff.
+func acceptProposal(filePath string, status int) ([]string, error) {
+	proposal, err := ProposeBaseline(filePath, status)
+	if err != nil || len(proposal.Diff) == 0 {
+		return proposal.Diff, err
+	}
+	return proposal.Diff, WriteBaseline(filePath, status, proposal.Schema)
+}
+
+func TestProposeBaseline(t *testing.T) {
+	t.Chdir(t.TempDir())
+	filePath := filepath.Join(RequestsDir, "users", "GET.yaml")
+
+	if _, err := ProposeBaseline(filePath, 200); !errors.Is(err, ErrNoSamples) {
+		t.Errorf("expected ErrNoSamples without a recorded sample, got %v", err)
+	}
+	for _, resp := range []Response{
+		{StatusCode: 200, RespBody: `{"id":1,"name":"a"}`},
+		{StatusCode: 500, RespBody: `{"error":"x"}`},
+		{StatusCode: 200, RespBody: `{"id": 1, "name": "a"}`},
+	} {
+		if err := recordSample(filePath, resp, nil); err != nil {
+			t.Fatalf("recordSample error: %v", err)
+		}
+	}
+	if samples, err := loadSamples(filePath, 200); err != nil || len(samples) != 1 {
+		t.Errorf("loadSamples = %d samples, %v; expected one: duplicates are not kept", len(samples), err)
+	}
+
+	// A proposal is not written until it is accepted
+	proposal, err := ProposeBaseline(filePath, 200)
+	if err != nil || !reflect.DeepEqual(proposal.Diff, []string{"+ (new baseline)"}) || proposal.Samples.Count != 1 {
+		t.Fatalf("first ProposeBaseline = %+v, %v", proposal, err)
+	}
+	if _, err := os.Stat(SchemaPath(filePath)); !os.IsNotExist(err) {
+		t.Errorf("ProposeBaseline wrote the baseline: %v", err)
+	}
+	diff, err := acceptProposal(filePath, 200)
+	if err != nil || len(diff) == 0 {
+		t.Fatalf("first acceptProposal = %q, %v", diff, err)
+	}
+	if _, err := os.Stat(SchemaPath(filePath)); err != nil {
+		t.Errorf("baseline not written: %v", err)
+	}
+	recordSample(filePath, Response{StatusCode: 200, RespBody: `{"id":2,"name":"b"}`}, nil)
+	if diff, err := acceptProposal(filePath, 200); err != nil || len(diff) != 0 {
+		t.Errorf("same shape should leave the baseline unchanged, got %q, %v", diff, err)
+	}
+
+	// A property missing from a later sample becomes optional
+	recordSample(filePath, Response{StatusCode: 200, RespBody: `{"id":3}`}, nil)
+	diff, err = acceptProposal(filePath, 200)
+	expected := []string{`+ optionalProperties: {"name":{"type":"string"}}`, `- properties.name: {"type":"string"}`}
+	if err != nil || !reflect.DeepEqual(diff, expected) {
+		t.Errorf("acceptProposal = %q, %v, expected %q", diff, err, expected)
+	}
+
+	// Only the newest schema.samples responses are kept
+	for i := 0; i < 5; i++ {
+		recordSample(filePath, Response{StatusCode: 200, RespBody: fmt.Sprintf(`{"id":%d}`, 10+i)}, &SchemaHints{Samples: 3})
+	}
+	if samples, _ := loadSamples(filePath, 200); len(samples) != 3 || string(samples[2].Body) != `{"id":14}` {
+		t.Errorf("expected the 3 newest samples, got %d", len(samples))
+	}
+
+	// Other statuses have their own samples and baselines
+	recordSample(filePath, Response{StatusCode: 200, RespBody: `not json`}, nil)
+	if statuses, err := SampleStatuses(filePath); err != nil || !reflect.DeepEqual(statuses, []int{200, 500}) {
+		t.Errorf("SampleStatuses = %v, %v, expected [200 500]", statuses, err)
+	}
+	if _, err := acceptProposal(filePath, 500); err != nil {
+		t.Fatalf("acceptProposal(500) error: %v", err)
+	}
+	schema, _ := os.ReadFile(filepath.Join(RequestsDir, "users", "GET.500.jtd.json"))
+	if !strings.Contains(string(schema), `"error"`) {
+		t.Errorf("expected GET.500.jtd.json to describe the error response, got %s", schema)
+	}
+}
+
+func TestRecordSampleRedacts(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestConfig(t, &Config{Env: "dev", Envs: map[string]Env{"dev": {Vars: map[string]string{"API_KEY": "k3y-from-env"}}}})
+	filePath := filepath.Join(RequestsDir, "auth", "login", "POST.yaml")
+	resp := Response{StatusCode: 200, RespBody: `{"access_token":"eyJ.a.b","refresh_token":"r1","expires_in":3600,` +
+		`"credentials":{"id":7,"key":"c1"},"note":"uses k3y-from-env"}`}
+	if err := recordSample(filePath, resp, nil); err != nil {
+		t.Fatalf("recordSample error: %v", err)
+	}
+
+	samples, err := loadSamples(filePath, 200)
+	if err != nil || len(samples) != 1 {
+		t.Fatalf("loadSamples = %d samples, %v", len(samples), err)
+	}
+	// Only strings are replaced, so the inferred baseline keeps the types
+	expected := `{"access_token":"[REDACTED]","credentials":{"id":7,"key":"[REDACTED]"},"expires_in":3600,"note":"uses [REDACTED]","refresh_token":"[REDACTED]"}`
+	if string(samples[0].Body) != expected {
+		t.Errorf("recorded %s, expected %s", samples[0].Body, expected)
+	}
+	if ignore, err := os.ReadFile(filepath.Join(SamplesDir, ".gitignore")); err != nil || string(ignore) != "*\n" {
+		t.Errorf("samples .gitignore = %q, %v", ignore, err)
+	}
+}
@@ -2,18 +2,54 @@ package util
 
 import (
 	"fmt"
-	"net/url"
 	"os"
-	"regexp"
-	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config is an internal struct for parsing config.yaml.
 type Config struct {
-	Env  string         `yaml:"env"`
-	Envs map[string]Env `yaml:"envs"`
+	Env  string            `yaml:"env"`
+	Vars map[string]string `yaml:"vars,omitempty"` // Global variables shared by every environment
+	Envs map[string]Env    `yaml:"envs"`
+}
+
+const defaultTimeout = 10 // Seconds
+
+// overrides holds per-invocation settings from the command line. They are never written to config.yaml.
+var overrides struct {
+	env  string
+	vars map[string]string
+}
+
+// UseEnv selects the environment for this invocation only, without changing config.yaml.
+func UseEnv(envName string) {
+	overrides.env = envName
+}
+
+// SetVarOverrides sets variables for this invocation only. They take precedence over every other layer.
+func SetVarOverrides(vars map[string]string) {
+	overrides.vars = vars
+}
+
+// activeEnvName returns the environment selected by --env, or the one stored in config.yaml.
+func (c *Config) activeEnvName() string {
+	if overrides.env != "" {
+		return overrides.env
+	}
+	return c.Env
+}
+
+// resolveVars merges variable layers for envName. Precedence, highest first:
+// command line (--var) > session > environment > global.
+func (c *Config) resolveVars(envName string, session map[string]string) map[string]string {
+	resolved := make(map[string]string)
+	for _, layer := range []map[string]string{c.Vars, c.Envs[envName].Vars, session, overrides.vars} {
+		for k, v := range layer {
+			resolved[k] = v
+		}
+	}
+	return resolved
 }
 
 // CheckRepoContext verifies if the current directory contains a valid localpost project.
@@ -32,7 +68,7 @@ func ReadConfig() (*Config, error) {
 	defaultEnv := map[string]Env{
 		"dev": {
 			Vars:    make(map[string]string),
-			Timeout: 10, // Default timeout: 10 seconds
+			Timeout: defaultTimeout,
 		},
 	}
 	defaultConfig := &Config{
@@ -67,21 +103,19 @@ func ReadConfig() (*Config, error) {
 		// If env doesn't exist, use default with empty vars
 		config.Envs[config.Env] = Env{
 			Vars:    make(map[string]string),
-			Timeout: defaultEnv["dev"].Timeout,
+			Timeout: defaultTimeout,
 		}
 	} else if currentEnv.Timeout == 0 {
 		// If env exists but timeout is unset, apply default
-		config.Envs[config.Env] = Env{
-			Vars:    currentEnv.Vars,
-			Login:   currentEnv.Login,
-			Timeout: currentEnv.Timeout,
-		}
+		currentEnv.Timeout = defaultTimeout
+		config.Envs[config.Env] = currentEnv
 	}
 
 	return &config, nil
 }
 
-// LoadEnv loads the current environment from config.yaml.
+// LoadEnv loads the active environment from config.yaml, honoring a --env override.
+// Resolved holds the environment's variables layered with globals, session and --var overrides.
 func LoadEnv() (Env, error) {
 	if err := CheckRepoContext(); err != nil {
 		return Env{}, err
@@ -92,24 +126,40 @@ func LoadEnv() (Env, error) {
 		return Env{}, err
 	}
 
-	currentEnv := config.Envs[config.Env]
-	currentEnv.Name = config.Env
+	envName := config.activeEnvName()
+	currentEnv, ok := config.Envs[envName]
+	if !ok && overrides.env != "" {
+		return Env{}, fmt.Errorf("environment %q not found in %s", envName, ConfigFilePath)
+	}
+	if currentEnv.Timeout == 0 {
+		currentEnv.Timeout = defaultTimeout
+	}
+	session, err := SessionVars(envName)
+	if err != nil {
+		return Env{}, fmt.Errorf("error loading session: %v", err)
+	}
+	currentEnv.Name = envName
+	currentEnv.Resolved = config.resolveVars(envName, session)
 	return currentEnv, nil
 }
 
-// SetEnvVar updates an environment variable in config.yaml for the current environment.
+// SetEnvVar updates an environment variable in config.yaml for the active environment.
 func SetEnvVar(key, value string) error {
 	config, err := ReadConfig()
 	if err != nil {
 		return fmt.Errorf("error reading config: %v", err)
 	}
 
-	currentEnv := config.Envs[config.Env]
+	envName := config.activeEnvName()
+	currentEnv, ok := config.Envs[envName]
+	if !ok {
+		return fmt.Errorf("environment %q not found in %s", envName, ConfigFilePath)
+	}
 	if currentEnv.Vars == nil {
 		currentEnv.Vars = make(map[string]string)
 	}
 	currentEnv.Vars[key] = value
-	config.Envs[config.Env] = currentEnv
+	config.Envs[envName] = currentEnv
 
 	return writeConfig(config)
 }
@@ -142,43 +192,3 @@ func writeConfig(config *Config) error {
 	}
 	return nil
 }
-
-// replacePlaceholders replaces placeholders like {VAR} in the input string or URL query params with values from vars.
-func replacePlaceholders(input string, vars map[string]string) (string, error) {
-	// Replace placeholders in the entire string first
-	replaced := replaceString(input, vars)
-
-	// Parse as URL to handle query params
-	u, err := url.Parse(replaced)
-	if err != nil {
-		return replaced, nil // If not a valid URL, return as-is
-	}
-
-	if u.RawQuery != "" {
-		// Handle URL query params
-		q := u.Query()
-		for key, values := range q {
-			if len(values) > 0 {
-				newVal := replaceString(values[0], vars)
-				if newVal != values[0] {
-					q.Set(key, newVal)
-				}
-			}
-		}
-		u.RawQuery = q.Encode()
-	}
-
-	return u.String(), nil
-}
-
-// replaceString replaces {VAR} placeholders in a string with values from vars.
-func replaceString(input string, vars map[string]string) string {
-	re := regexp.MustCompile(`\{([^}]+)\}`)
-	return re.ReplaceAllStringFunc(input, func(match string) string {
-		key := strings.Trim(match, "{}")
-		if value, ok := vars[key]; ok {
-			return value
-		}
-		return match
-	})
-}
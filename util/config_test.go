@@ -0,0 +1,99 @@
+package util
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// writeTestConfig creates the lpost directory with config.yaml holding config.
+func writeTestConfig(t *testing.T, config *Config) {
+	t.Helper()
+	if err := os.MkdirAll(LocalpostDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeConfig(config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadEnvPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		global   string
+		env      string
+		session  string
+		override string
+		useEnv   string
+		expected string
+	}{
+		{name: "global only", global: "global", expected: "global"},
+		{name: "env over global", global: "global", env: "env", expected: "env"},
+		{name: "session over env", global: "global", env: "env", session: "session", expected: "session"},
+		{name: "var over session", global: "global", env: "env", session: "session", override: "var", expected: "var"},
+		{name: "var over global", global: "global", override: "var", expected: "var"},
+		{name: "--env selects layers", global: "global", env: "env", session: "session", useEnv: "prod", expected: "prod"},
+		{name: "unset", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Cleanup(func() { UseEnv(""); SetVarOverrides(nil) })
+			config := &Config{Env: "dev", Vars: map[string]string{}, Envs: map[string]Env{
+				"dev":  {Vars: map[string]string{}},
+				"prod": {Vars: map[string]string{"VALUE": "prod"}},
+			}}
+			if tt.global != "" {
+				config.Vars["VALUE"] = tt.global
+			}
+			if tt.env != "" {
+				config.Envs["dev"].Vars["VALUE"] = tt.env
+			}
+			writeTestConfig(t, config)
+			if tt.session != "" {
+				if err := SetSessionVar("VALUE", tt.session); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.override != "" {
+				SetVarOverrides(map[string]string{"VALUE": tt.override})
+			}
+			UseEnv(tt.useEnv)
+
+			env, err := LoadEnv()
+			if err != nil {
+				t.Fatalf("LoadEnv error: %v", err)
+			}
+			if got := env.Resolved["VALUE"]; got != tt.expected {
+				t.Errorf("VALUE = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUnknownEnvOverride(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Cleanup(func() { UseEnv("") })
+	writeTestConfig(t, &Config{Env: "dev", Envs: map[string]Env{"dev": {Vars: map[string]string{"BASE_URL": "http://dev"}}}})
+	before, err := os.ReadFile(ConfigFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	UseEnv("staging")
+	if _, err := LoadEnv(); err == nil || !strings.Contains(err.Error(), `environment "staging" not found`) {
+		t.Errorf("LoadEnv error = %v, expected unknown environment", err)
+	}
+	if err := SetEnvVar("TOKEN", "x"); err == nil {
+		t.Error("SetEnvVar should fail for an unknown environment")
+	}
+
+	after, err := os.ReadFile(ConfigFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("config.yaml changed:\n%s", after)
+	}
+}
@@ -6,5 +6,6 @@ const ConfigFile = "config.yaml"
 const ConfigFilePath = LocalpostDir + "/" + ConfigFile
 const EphemeralFile = ".ephemeral.yaml"
 const EphemeralFilePath = LocalpostDir + "/" + EphemeralFile
+const SamplesDir = LocalpostDir + "/.samples"
 const GitignoreFile = ".gitignore"
 const GitignoreFilePath = LocalpostDir + "/" + GitignoreFile
@@ -0,0 +1,314 @@
+package util
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StoredCookie is a cookie persisted in .ephemeral.yaml together with its RFC 6265 scope.
+type StoredCookie struct {
+	Name     string    `yaml:"name"`
+	Value    string    `yaml:"value"`
+	Domain   string    `yaml:"domain"`
+	Path     string    `yaml:"path"`
+	HostOnly bool      `yaml:"host-only,omitempty"` // No Domain attribute: sent to the exact host only
+	Secure   bool      `yaml:"secure,omitempty"`
+	HttpOnly bool      `yaml:"http-only,omitempty"`
+	Expires  time.Time `yaml:"expires,omitempty"` // Zero for session cookies
+}
+
+// CookieStore maps an environment name to its cookies.
+type CookieStore map[string][]StoredCookie
+
+// UnmarshalYAML skips entries that are not cookie lists, such as the flat
+// name: value map written by older versions.
+func (s *CookieStore) UnmarshalYAML(value *yaml.Node) error {
+	*s = make(CookieStore)
+	if value.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		var cookies []StoredCookie
+		if err := value.Content[i+1].Decode(&cookies); err != nil {
+			continue
+		}
+		(*s)[value.Content[i].Value] = cookies
+	}
+	return nil
+}
+
+// Expired reports whether the cookie's expiry has passed. Session cookies never expire.
+func (c StoredCookie) Expired() bool {
+	return c.expired(time.Now())
+}
+
+func (c StoredCookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+func (c StoredCookie) sameKey(other StoredCookie) bool {
+	return c.Name == other.Name && c.Domain == other.Domain && c.Path == other.Path
+}
+
+// matches reports whether the cookie should be sent to u (RFC 6265 section 5.4).
+func (c StoredCookie) matches(u *url.URL) bool {
+	host := canonicalHost(u.Hostname())
+	if c.HostOnly {
+		if host != c.Domain {
+			return false
+		}
+	} else if !domainMatch(host, c.Domain) {
+		return false
+	}
+	if c.Secure && u.Scheme != "https" {
+		return false
+	}
+	return pathMatch(requestPath(u), c.Path)
+}
+
+// Jar is a persistent cookie jar scoped to one environment. It implements http.CookieJar,
+// so switching environments never sends one environment's cookies to another.
+// Changes are kept in memory until Save merges them into .ephemeral.yaml.
+type Jar struct {
+	mu      sync.Mutex
+	env     string
+	cookies []StoredCookie
+	changes []StoredCookie // Upserts and deletions (expired entries) since load
+}
+
+// LoadJar loads the cookie jar for envName from .ephemeral.yaml.
+func LoadJar(envName string) (*Jar, error) {
+	ephemeralMu.Lock()
+	defer ephemeralMu.Unlock()
+	eph, err := loadEphemeral()
+	if err != nil {
+		return nil, err
+	}
+	jar := &Jar{env: envName}
+	now := time.Now()
+	for _, c := range eph.Cookies[envName] {
+		if !c.expired(now) {
+			jar.cookies = append(jar.cookies, c)
+		}
+	}
+	return jar, nil
+}
+
+// SetCookies stores cookies received from u, applying RFC 6265 domain, path and expiry rules.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	host := canonicalHost(u.Hostname())
+	for _, hc := range cookies {
+		c := StoredCookie{
+			Name:     hc.Name,
+			Value:    hc.Value,
+			Secure:   hc.Secure,
+			HttpOnly: hc.HttpOnly,
+		}
+
+		domain := canonicalHost(strings.TrimPrefix(hc.Domain, "."))
+		switch {
+		case domain == "" || domain == host:
+			c.Domain = host
+			c.HostOnly = domain == ""
+		case domainMatch(host, domain) && strings.Contains(domain, ".") && net.ParseIP(host) == nil:
+			c.Domain = domain
+		default:
+			continue // Domain attribute does not cover the request host
+		}
+
+		c.Path = hc.Path
+		if c.Path == "" || !strings.HasPrefix(c.Path, "/") {
+			c.Path = defaultPath(u)
+		}
+
+		switch {
+		case hc.MaxAge < 0:
+			c.Expires = time.Unix(0, 0)
+		case hc.MaxAge > 0:
+			c.Expires = now.Add(time.Duration(hc.MaxAge) * time.Second)
+		case !hc.Expires.IsZero():
+			c.Expires = hc.Expires
+		}
+
+		j.upsert(c, now)
+		j.changes = append(j.changes, c)
+	}
+}
+
+// Cookies returns the cookies to send to u, longest path first.
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	var matched []StoredCookie
+	for _, c := range j.cookies {
+		if !c.expired(now) && c.matches(u) {
+			matched = append(matched, c)
+		}
+	}
+	sort.SliceStable(matched, func(a, b int) bool {
+		return len(matched[a].Path) > len(matched[b].Path)
+	})
+	out := make([]*http.Cookie, 0, len(matched))
+	for _, c := range matched {
+		out = append(out, &http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	return out
+}
+
+// Save merges the jar's changes into .ephemeral.yaml. Cookies stored concurrently by
+// other requests are preserved.
+func (j *Jar) Save() error {
+	j.mu.Lock()
+	changes := j.changes
+	j.changes = nil
+	j.mu.Unlock()
+	if len(changes) == 0 {
+		return nil
+	}
+	return updateEphemeral(func(eph *Ephemeral) {
+		if eph.Cookies == nil {
+			eph.Cookies = make(CookieStore)
+		}
+		merged := &Jar{cookies: eph.Cookies[j.env]}
+		now := time.Now()
+		for _, c := range changes {
+			merged.upsert(c, now)
+		}
+		if len(merged.cookies) == 0 {
+			delete(eph.Cookies, j.env)
+		} else {
+			eph.Cookies[j.env] = merged.cookies
+		}
+	})
+}
+
+// upsert replaces the cookie with the same name, domain and path, or removes it when c is expired.
+func (j *Jar) upsert(c StoredCookie, now time.Time) {
+	kept := j.cookies[:0]
+	for _, existing := range j.cookies {
+		if !existing.sameKey(c) && !existing.expired(now) {
+			kept = append(kept, existing)
+		}
+	}
+	j.cookies = kept
+	if !c.expired(now) {
+		j.cookies = append(j.cookies, c)
+	}
+}
+
+// All returns every unexpired cookie in the jar, sorted by domain, path and name.
+func (j *Jar) All() []StoredCookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	var out []StoredCookie
+	for _, c := range j.cookies {
+		if !c.expired(now) {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Domain != out[b].Domain {
+			return out[a].Domain < out[b].Domain
+		}
+		if out[a].Path != out[b].Path {
+			return out[a].Path < out[b].Path
+		}
+		return out[a].Name < out[b].Name
+	})
+	return out
+}
+
+// Put adds or replaces a cookie as-is, without request-based scoping.
+func (j *Jar) Put(c StoredCookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	c.Domain = canonicalHost(strings.TrimPrefix(c.Domain, "."))
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	j.upsert(c, time.Now())
+	j.changes = append(j.changes, c)
+}
+
+// Remove deletes every cookie for which match returns true and reports how many were removed.
+func (j *Jar) Remove(match func(c StoredCookie) bool) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	removed := 0
+	now := time.Now()
+	for _, c := range j.cookies {
+		if match(c) {
+			c.Expires = time.Unix(0, 0)
+			j.changes = append(j.changes, c)
+			removed++
+		}
+	}
+	for _, c := range j.changes[len(j.changes)-removed:] {
+		j.upsert(c, now)
+	}
+	return removed
+}
+
+// InDomain reports whether the cookie belongs to domain or one of its subdomains.
+func (c StoredCookie) InDomain(domain string) bool {
+	return domain == "" || domainMatch(c.Domain, canonicalHost(strings.TrimPrefix(domain, ".")))
+}
+
+// ClearCookies removes every cookie stored for envName.
+func ClearCookies(envName string) error {
+	return updateEphemeral(func(eph *Ephemeral) {
+		delete(eph.Cookies, envName)
+	})
+}
+
+func canonicalHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// domainMatch implements RFC 6265 section 5.1.3.
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return strings.HasSuffix(host, "."+domain) && net.ParseIP(host) == nil
+}
+
+// pathMatch implements RFC 6265 section 5.1.4.
+func pathMatch(reqPath, cookiePath string) bool {
+	if reqPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(reqPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || reqPath[len(cookiePath)] == '/'
+}
+
+func requestPath(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+// defaultPath implements RFC 6265 section 5.1.4 default-path.
+func defaultPath(u *url.URL) string {
+	p := requestPath(u)
+	i := strings.LastIndex(p, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return p[:i]
+}
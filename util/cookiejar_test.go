@@ -0,0 +1,101 @@
+package util
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJarScoping(t *testing.T) {
+	jar := &Jar{env: "dev"}
+	mustParse := func(raw string) *url.URL {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("parse %q: %v", raw, err)
+		}
+		return u
+	}
+
+	jar.SetCookies(mustParse("https://api.example.com/auth/login"), []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "shared", Value: "2", Domain: ".example.com", Path: "/"},
+		{Name: "admin", Value: "3", Path: "/admin"},
+		{Name: "secure", Value: "4", Path: "/", Secure: true},
+		{Name: "old", Value: "5", Path: "/", Expires: time.Now().Add(-time.Hour)},
+		{Name: "evil", Value: "6", Domain: "other.com"},
+	})
+
+	tests := []struct {
+		url      string
+		expected []string
+	}{
+		{"https://api.example.com/auth/me", []string{"host", "shared", "secure"}},
+		{"https://api.example.com/admin/users", []string{"admin", "shared", "secure"}},
+		{"http://api.example.com/", []string{"shared"}},
+		{"https://www.example.com/", []string{"shared"}},
+		{"https://other.com/", nil},
+	}
+
+	for _, tt := range tests {
+		var names []string
+		for _, c := range jar.Cookies(mustParse(tt.url)) {
+			names = append(names, c.Name)
+		}
+		if len(names) != len(tt.expected) {
+			t.Errorf("Cookies(%s) = %v, expected %v", tt.url, names, tt.expected)
+			continue
+		}
+		for i := range names {
+			if names[i] != tt.expected[i] {
+				t.Errorf("Cookies(%s) = %v, expected %v", tt.url, names, tt.expected)
+				break
+			}
+		}
+	}
+
+	// Max-Age < 0 deletes the cookie
+	jar.SetCookies(mustParse("https://api.example.com/"), []*http.Cookie{{Name: "shared", Domain: "example.com", Path: "/", MaxAge: -1}})
+	for _, c := range jar.Cookies(mustParse("https://www.example.com/")) {
+		if c.Name == "shared" {
+			t.Errorf("expected shared cookie to be deleted")
+		}
+	}
+}
+
+func TestNetscapeCookiesRoundTrip(t *testing.T) {
+	input := "# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tTRUE\t4102444800\tsid\tabc\n" +
+		"#HttpOnly_api.example.com\tFALSE\t/v1\tFALSE\t0\ttoken\txyz\n"
+
+	cookies, err := ParseNetscapeCookies(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseNetscapeCookies error: %v", err)
+	}
+	if len(cookies) != 2 {
+		t.Fatalf("expected 2 cookies, got %d", len(cookies))
+	}
+	if c := cookies[0]; c.Domain != "example.com" || c.HostOnly || !c.Secure || c.Expires.Unix() != 4102444800 {
+		t.Errorf("unexpected first cookie: %+v", c)
+	}
+	if c := cookies[1]; c.Domain != "api.example.com" || !c.HostOnly || !c.HttpOnly || !c.Expires.IsZero() || c.Path != "/v1" {
+		t.Errorf("unexpected second cookie: %+v", c)
+	}
+
+	var out strings.Builder
+	if err := WriteNetscapeCookies(&out, cookies); err != nil {
+		t.Fatalf("WriteNetscapeCookies error: %v", err)
+	}
+	if out.String() != input {
+		t.Errorf("round trip mismatch:\n%s\nexpected:\n%s", out.String(), input)
+	}
+
+	if cookies[0].Expired() || cookies[1].Expired() {
+		t.Error("cookies expiring in the future and session cookies should not be expired")
+	}
+	stale, _ := ParseNetscapeCookies(strings.NewReader(".example.com\tTRUE\t/\tFALSE\t1000\tsid\tstale\n"))
+	if len(stale) != 1 || !stale[0].Expired() {
+		t.Errorf("a cookie that expired in 1970 should be expired: %+v", stale)
+	}
+}
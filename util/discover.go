@@ -0,0 +1,129 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestFilter selects the requests run by lpost test. Globs match request paths such as
+// users/{id}/GET: * and ? stay within a directory, ** spans directories, and a pattern
+// without wildcards also matches everything below it.
+type TestFilter struct {
+	Patterns []string // Run only requests matching one of these globs; all if empty
+	Tags     []string // Run only requests with at least one of these tags; all if empty
+	Exclude  []string // Skip requests matching one of these globs
+}
+
+// DiscoverRequests walks the requests directory and returns the files selected by filter, sorted.
+// Folder setup and teardown hooks are not selected; PlanTests adds them around their folder.
+func DiscoverRequests(filter TestFilter) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(RequestsDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == HookSetup || d.Name() == HookTeardown) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".yaml") {
+			return nil
+		}
+		requestPath, err := filepath.Rel(RequestsDir, path)
+		if err != nil {
+			return err
+		}
+		requestPath = strings.TrimSuffix(filepath.ToSlash(requestPath), ".yaml")
+
+		if len(filter.Patterns) > 0 && !matchAnyGlob(filter.Patterns, requestPath) {
+			return nil
+		}
+		if matchAnyGlob(filter.Exclude, requestPath) {
+			return nil
+		}
+		if len(filter.Tags) > 0 {
+			meta, err := readRequestMeta(path)
+			if err != nil {
+				return err
+			}
+			if !slices.ContainsFunc(filter.Tags, func(tag string) bool { return slices.Contains(meta.Tags, tag) }) {
+				return nil
+			}
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", RequestsDir, err)
+	}
+	return files, nil
+}
+
+// MatchRequestGlob reports whether a request path such as users/{id}/GET matches pattern.
+func MatchRequestGlob(pattern, requestPath string) bool {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	requestPath = strings.Trim(requestPath, "/")
+	if !strings.ContainsAny(pattern, "*?") {
+		return requestPath == pattern || strings.HasPrefix(requestPath, pattern+"/")
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			i++
+			if i+1 < len(pattern) && pattern[i+1] == '/' {
+				i++
+				expr.WriteString("(.*/)?") // **/ matches zero or more directories
+			} else {
+				expr.WriteString(".*")
+			}
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	matched, err := regexp.MatchString(expr.String(), requestPath)
+	return err == nil && matched
+}
+
+func matchAnyGlob(patterns []string, requestPath string) bool {
+	for _, pattern := range patterns {
+		if MatchRequestGlob(pattern, requestPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestMeta is the part of a request file lpost test selects and orders requests by.
+type requestMeta struct {
+	Tags      []string `yaml:"tags"`
+	DependsOn []string `yaml:"depends-on"`
+	Retries   Retries  `yaml:"retries"`
+	Expect    struct {
+		Status StatusList `yaml:"status"`
+	} `yaml:"expect"`
+}
+
+// readRequestMeta reads only the tags, dependencies and retries of a request file, without resolving its URL.
+func readRequestMeta(filePath string) (requestMeta, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return requestMeta{}, err
+	}
+	var meta requestMeta
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return requestMeta{}, fmt.Errorf("error parsing %s: %v", filePath, err)
+	}
+	return meta, nil
+}
@@ -0,0 +1,78 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchRequestGlob(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		expected      bool
+	}{
+		{"users", "users/{id}/GET", true},
+		{"/users/", "users/GET", true},
+		{"user", "users/GET", false},
+		{"users/*", "users/GET", true},
+		{"users/*", "users/{id}/GET", false},
+		{"users/**", "users/{id}/GET", true},
+		{"**/GET", "GET", true},
+		{"**/GET", "a/b/GET", true},
+		{"**/POST*", "a/POST@admin", true},
+		{"a/?ET", "a/GET", true},
+		{"users/{id}/GET", "users/{id}/GET", true},
+	}
+	for _, tt := range tests {
+		if got := MatchRequestGlob(tt.pattern, tt.path); got != tt.expected {
+			t.Errorf("MatchRequestGlob(%q, %q) = %v, expected %v", tt.pattern, tt.path, got, tt.expected)
+		}
+	}
+}
+
+func TestDiscoverRequests(t *testing.T) {
+	t.Chdir(t.TempDir())
+	files := map[string]string{
+		"GET.yaml":                "tags: [smoke]\n",
+		"users/{id}/GET.yaml":     "tags: [smoke, users]\n",
+		"users/POST.yaml":         "tags: [users]\n",
+		"users/POST.invalid.yaml": "",
+		"admin/settings/PUT.yaml": "tags: [smoke]\n",
+		"users/{id}/GET.jtd.json": "{}",
+		"users/_setup/POST.yaml":  "tags: [smoke]\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(RequestsDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		filter   TestFilter
+		expected []string
+	}{
+		{TestFilter{}, []string{"GET", "admin/settings/PUT", "users/POST.invalid", "users/POST", "users/{id}/GET"}},
+		{TestFilter{Patterns: []string{"users"}}, []string{"users/POST.invalid", "users/POST", "users/{id}/GET"}},
+		{TestFilter{Tags: []string{"smoke"}, Exclude: []string{"admin/**"}}, []string{"GET", "users/{id}/GET"}},
+		{TestFilter{Patterns: []string{"users/*"}, Tags: []string{"users"}}, []string{"users/POST"}},
+	}
+	for _, tt := range tests {
+		found, err := DiscoverRequests(tt.filter)
+		if err != nil {
+			t.Fatalf("DiscoverRequests(%+v) error: %v", tt.filter, err)
+		}
+		var paths []string
+		for _, file := range found {
+			rel, _ := filepath.Rel(RequestsDir, file)
+			paths = append(paths, filepath.ToSlash(rel[:len(rel)-len(".yaml")]))
+		}
+		if !reflect.DeepEqual(paths, tt.expected) {
+			t.Errorf("DiscoverRequests(%+v) = %v, expected %v", tt.filter, paths, tt.expected)
+		}
+	}
+}
@@ -3,52 +3,97 @@ package util
 import (
 	"fmt"
 	"os"
+	"sync"
 
 	"gopkg.in/yaml.v3"
 )
 
-// LoadCookies reads runtime cookies from .ephemeral (YAML).
-func LoadCookies() (map[string]string, error) {
+// ephemeralMu serializes read-modify-write cycles on .ephemeral.yaml within this process.
+var ephemeralMu sync.Mutex
+
+// loadEphemeral reads runtime state from .ephemeral.yaml. A missing file is an empty state.
+func loadEphemeral() (Ephemeral, error) {
+	var eph Ephemeral
 	data, err := os.ReadFile(EphemeralFilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return make(map[string]string), nil
+			return eph, nil
 		}
-		return nil, fmt.Errorf("error reading %s: %v", EphemeralFilePath, err)
+		return eph, fmt.Errorf("error reading %s: %v", EphemeralFilePath, err)
 	}
-	var cookies map[string]string
-	if err := yaml.Unmarshal(data, &cookies); err != nil {
-		return nil, fmt.Errorf("error parsing %s: %v", EphemeralFilePath, err)
+	if err := yaml.Unmarshal(data, &eph); err != nil {
+		return eph, fmt.Errorf("error parsing %s: %v", EphemeralFilePath, err)
 	}
-	return cookies, nil
+	return eph, nil
 }
 
-// SaveCookies writes runtime cookies to .ephemeral (YAML).
-func SaveCookies(cookies map[string]string) error {
-	data, err := yaml.Marshal(cookies)
+// saveEphemeral writes runtime state to .ephemeral.yaml.
+func saveEphemeral(eph Ephemeral) error {
+	data, err := yaml.Marshal(eph)
 	if err != nil {
-		return fmt.Errorf("error marshaling cookies: %v", err)
+		return fmt.Errorf("error marshaling %s: %v", EphemeralFilePath, err)
 	}
 	return os.WriteFile(EphemeralFilePath, data, 0644)
 }
 
-// ClearCookies removes the .ephemeral file.
-func ClearCookies() error {
-	err := os.Remove(EphemeralFilePath)
+// updateEphemeral applies fn to the stored state and saves the result.
+func updateEphemeral(fn func(eph *Ephemeral)) error {
+	ephemeralMu.Lock()
+	defer ephemeralMu.Unlock()
+	eph, err := loadEphemeral()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
+		return err
+	}
+	fn(&eph)
+	return saveEphemeral(eph)
+}
+
+// SessionVars returns the session variables captured for envName.
+func SessionVars(envName string) (map[string]string, error) {
+	ephemeralMu.Lock()
+	defer ephemeralMu.Unlock()
+	eph, err := loadEphemeral()
+	if err != nil {
+		return nil, err
 	}
-	return err
+	return eph.Vars[envName], nil
 }
 
-// SetCookie adds or updates a single cookie in .ephemeral.
-func SetCookie(name, value string) error {
-	cookies, err := LoadCookies()
+// SetSessionVar stores a session variable for the active environment.
+func SetSessionVar(key, value string) error {
+	config, err := ReadConfig()
 	if err != nil {
-		return fmt.Errorf("error loading cookies: %v", err)
+		return fmt.Errorf("error reading config: %v", err)
 	}
-	cookies[name] = value
-	return SaveCookies(cookies)
+	return setSessionVars(config.activeEnvName(), map[string]string{key: value})
+}
+
+// setSessionVars stores several session variables for envName in one write. Empty values are deleted.
+func setSessionVars(envName string, vars map[string]string) error {
+	return updateEphemeral(func(eph *Ephemeral) {
+		if eph.Vars == nil {
+			eph.Vars = make(map[string]map[string]string)
+		}
+		if eph.Vars[envName] == nil {
+			eph.Vars[envName] = make(map[string]string)
+		}
+		for key, value := range vars {
+			if value == "" {
+				delete(eph.Vars[envName], key)
+			} else {
+				eph.Vars[envName][key] = value
+			}
+		}
+	})
+}
+
+// ClearSession removes the session variables of envName, or of every environment if envName is empty.
+func ClearSession(envName string) error {
+	return updateEphemeral(func(eph *Ephemeral) {
+		if envName == "" {
+			eph.Vars = nil
+			return
+		}
+		delete(eph.Vars, envName)
+	})
 }
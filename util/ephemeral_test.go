@@ -0,0 +1,67 @@
+package util
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestSessionStore(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Cleanup(func() { UseEnv("") })
+	writeTestConfig(t, &Config{Env: "prod", Envs: map[string]Env{"dev": {}, "prod": {}}})
+	UseEnv("dev")
+	if err := SetSessionVar("TOKEN", "dev-token"); err != nil {
+		t.Fatal(err)
+	}
+	UseEnv("")
+
+	// Captured values go to the session of the active environment, persisted ones to config.yaml
+	reqDef := RequestDefinition{SetEnv: map[string]SetEnvSource{
+		"TOKEN":   {Body: "token"},
+		"USER_ID": {Body: "id", Persist: true},
+		"MISSING": {Body: "missing"},
+	}}
+	if err := processResponse(reqDef, Response{RespBody: `{"token":"prod-token","id":7}`}); err != nil {
+		t.Fatalf("processResponse error: %v", err)
+	}
+	eph, err := loadEphemeral()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]map[string]string{"dev": {"TOKEN": "dev-token"}, "prod": {"TOKEN": "prod-token"}}
+	if !maps.EqualFunc(eph.Vars, expected, maps.Equal) {
+		t.Errorf("session vars = %v, expected %v", eph.Vars, expected)
+	}
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Envs["prod"].Vars["USER_ID"] != "7" || len(config.Envs["dev"].Vars) != 0 {
+		t.Errorf("config vars = %v, expected USER_ID=7 in prod only", config.Envs)
+	}
+
+	// An empty value deletes the entry
+	if err := setSessionVars("prod", map[string]string{"TOKEN": "", "OTHER": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if vars, _ := SessionVars("prod"); len(vars) != 1 || vars["OTHER"] != "x" {
+		t.Errorf("prod session = %v, expected only OTHER", vars)
+	}
+
+	// A named environment clears only that one, an empty name clears them all
+	if err := ClearSession("prod"); err != nil {
+		t.Fatal(err)
+	}
+	if vars, _ := SessionVars("prod"); len(vars) != 0 {
+		t.Errorf("prod session = %v after clearing it", vars)
+	}
+	if vars, _ := SessionVars("dev"); vars["TOKEN"] != "dev-token" {
+		t.Errorf("dev session = %v, expected it to survive clearing prod", vars)
+	}
+	if err := ClearSession(""); err != nil {
+		t.Fatal(err)
+	}
+	if eph, _ := loadEphemeral(); len(eph.Vars) != 0 {
+		t.Errorf("session vars = %v after clearing every environment", eph.Vars)
+	}
+}
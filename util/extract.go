@@ -0,0 +1,54 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// extractValue reads the value described by source from resp.
+// It returns an empty string when the source does not match anything.
+func extractValue(source SetEnvSource, resp Response) (string, error) {
+	switch {
+	case source.Header != "":
+		return http.Header(resp.RespHeaders).Get(source.Header), nil
+	case source.Body != "":
+		doc, err := decodeJSON(resp.RespBody)
+		if err != nil {
+			return "", nil
+		}
+		value, found, err := lookupJSONPath(doc, source.Body)
+		if err != nil {
+			return "", err
+		}
+		if !found || value == nil {
+			return "", nil
+		}
+		return stringifyJSONValue(value), nil
+	case source.Status:
+		return strconv.Itoa(resp.StatusCode), nil
+	case source.Cookie != "":
+		httpResp := http.Response{Header: http.Header(resp.RespHeaders)}
+		for _, cookie := range httpResp.Cookies() {
+			if cookie.Name == source.Cookie {
+				return cookie.Value, nil
+			}
+		}
+		return "", nil
+	case source.Regex != "":
+		re, err := regexp.Compile(source.Regex)
+		if err != nil {
+			return "", fmt.Errorf("invalid regex %q: %v", source.Regex, err)
+		}
+		match := re.FindStringSubmatch(resp.RespBody)
+		if match == nil {
+			return "", nil
+		}
+		if len(match) > 1 {
+			return match[1], nil
+		}
+		return match[0], nil
+	}
+	return "", fmt.Errorf("no source set (expected one of header, body, status, cookie, regex)")
+}
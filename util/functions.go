@@ -0,0 +1,183 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRandomStringLength bounds {$randomString n}, so a typo in n cannot exhaust memory.
+const maxRandomStringLength = 65536
+
+// generators produce a fresh value each time a {$name args...} placeholder is resolved.
+var generators = map[string]func(args []string) (string, error){
+	"uuid": func(args []string) (string, error) {
+		return newUUID()
+	},
+	"timestamp": func(args []string) (string, error) {
+		return strconv.FormatInt(time.Now().Unix(), 10), nil
+	},
+	"timestampMs": func(args []string) (string, error) {
+		return strconv.FormatInt(time.Now().UnixMilli(), 10), nil
+	},
+	"isoNow": func(args []string) (string, error) {
+		return time.Now().UTC().Format(time.RFC3339), nil
+	},
+	"randomInt": func(args []string) (string, error) {
+		min, max := int64(0), int64(1000)
+		if len(args) == 2 {
+			var err error
+			if min, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+				return "", fmt.Errorf("invalid min %q", args[0])
+			}
+			if max, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				return "", fmt.Errorf("invalid max %q", args[1])
+			}
+		} else if len(args) != 0 {
+			return "", fmt.Errorf("expected 0 or 2 arguments (min max), got %d", len(args))
+		}
+		if max < min {
+			return "", fmt.Errorf("max %d is less than min %d", max, min)
+		}
+		// max-min+1 overflows int64 for wide ranges, so it is computed as a big.Int
+		span := new(big.Int).Sub(big.NewInt(max), big.NewInt(min))
+		n, err := rand.Int(rand.Reader, span.Add(span, big.NewInt(1)))
+		if err != nil {
+			return "", err
+		}
+		return n.Add(n, big.NewInt(min)).String(), nil
+	},
+	"randomString": func(args []string) (string, error) {
+		length := 12
+		if len(args) == 1 {
+			var err error
+			if length, err = strconv.Atoi(args[0]); err != nil || length <= 0 {
+				return "", fmt.Errorf("invalid length %q", args[0])
+			}
+			if length > maxRandomStringLength {
+				return "", fmt.Errorf("length %d is more than %d", length, maxRandomStringLength)
+			}
+		} else if len(args) != 0 {
+			return "", fmt.Errorf("expected 0 or 1 argument (length), got %d", len(args))
+		}
+		return randomHex(length)
+	},
+	"randomEmail": func(args []string) (string, error) {
+		local, err := randomHex(10)
+		if err != nil {
+			return "", err
+		}
+		return "user-" + local + "@example.com", nil
+	},
+}
+
+// filters transform a value in a {VAR|filter args...} placeholder. Arguments are already
+// resolved: quoted literals are unquoted and bare words are looked up as variables.
+var filters = map[string]func(value string, args []string) (string, error){
+	"base64": func(value string, args []string) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(value)), nil
+	},
+	"sha256": func(value string, args []string) (string, error) {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:]), nil
+	},
+	"urlencode": func(value string, args []string) (string, error) {
+		return url.QueryEscape(value), nil
+	},
+	"pathescape": func(value string, args []string) (string, error) {
+		return url.PathEscape(value), nil
+	},
+	// hmac KEY [sha256|sha1|sha512] returns the hex digest of value
+	"hmac": func(value string, args []string) (string, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return "", fmt.Errorf("expected a key and an optional algorithm")
+		}
+		algo := "sha256"
+		if len(args) == 2 {
+			algo = args[1]
+		}
+		var newHash func() hash.Hash
+		switch algo {
+		case "sha256":
+			newHash = sha256.New
+		case "sha1":
+			newHash = sha1.New
+		case "sha512":
+			newHash = sha512.New
+		default:
+			return "", fmt.Errorf("unsupported algorithm %q", algo)
+		}
+		mac := hmac.New(newHash, []byte(args[0]))
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	},
+}
+
+// splitArgs splits a placeholder expression on whitespace, keeping quoted strings together.
+// Quoted words are returned with their quotes so callers can tell literals from names.
+func splitArgs(s string) []string {
+	var args []string
+	var current strings.Builder
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			current.WriteByte(c)
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			current.WriteByte(c)
+		case c == ' ' || c == '\t':
+			if current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if current.Len() > 0 {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// unquote returns the literal inside a quoted word and whether it was quoted.
+func unquote(word string) (string, bool) {
+	if len(word) >= 2 && (word[0] == '"' || word[0] == '\'') && word[len(word)-1] == word[0] {
+		return word[1 : len(word)-1], true
+	}
+	return word, false
+}
+
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+func randomHex(length int) (string, error) {
+	b := make([]byte, (length+1)/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b)[:length], nil
+}
@@ -0,0 +1,140 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	jtdinfer "github.com/bombsimon/jtd-infer-go"
+	jtd "github.com/jsontypedef/json-typedef-go"
+	"gopkg.in/yaml.v3"
+)
+
+func (h *SchemaHints) sampleLimit() int {
+	if h == nil || h.Samples <= 0 {
+		return defaultSampleLimit
+	}
+	return h.Samples
+}
+
+// inferHints converts the enum and discriminator paths to jtd-infer hints.
+func (h SchemaHints) inferHints() jtdinfer.Hints {
+	hints := jtdinfer.Hints{Enums: jtdinfer.NewHintSet(), Discriminator: jtdinfer.NewHintSet()}
+	for _, path := range h.Enums {
+		hints.Enums = hints.Enums.Add(hintPath(path, jtdinfer.Wildcard))
+	}
+	for _, path := range h.Discriminators {
+		hints.Discriminator = hints.Discriminator.Add(hintPath(path, jtdinfer.Wildcard))
+	}
+	return hints
+}
+
+// hintPath splits a path such as data.items[*].kind into its segments, replacing * with wildcard.
+// An empty path or $ is the response root.
+func hintPath(path, wildcard string) []string {
+	path = strings.NewReplacer("[", ".", "]", "").Replace(strings.TrimSpace(path))
+	path = strings.Trim(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return []string{}
+	}
+	segments := strings.Split(path, ".")
+	for i, segment := range segments {
+		if segment == "*" {
+			segments[i] = wildcard
+		}
+	}
+	return segments
+}
+
+// readSchemaHints reads only the schema block of a request file, without resolving its URL.
+func readSchemaHints(filePath string) (SchemaHints, error) {
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return SchemaHints{}, nil
+	}
+	if err != nil {
+		return SchemaHints{}, err
+	}
+	var req struct {
+		Schema SchemaHints `yaml:"schema"`
+	}
+	if err := yaml.Unmarshal(data, &req); err != nil {
+		return SchemaHints{}, fmt.Errorf("error parsing %s: %v", filePath, err)
+	}
+	return req.Schema, nil
+}
+
+// refineSchema applies the hints jtd-infer has no option for and sorts enum values,
+// so inferring from the same samples always gives the same baseline.
+func refineSchema(s *jtdinfer.Schema, hints SchemaHints) {
+	if hints.Timestamps != nil && !*hints.Timestamps {
+		walkSchema(s, func(s *jtdinfer.Schema) {
+			if s.Type == jtd.TypeTimestamp {
+				s.Type = jtd.TypeString
+			}
+		})
+	}
+	for _, path := range hints.Optional {
+		makeOptional(s, hintPath(path, "*"))
+	}
+	walkSchema(s, func(s *jtdinfer.Schema) { sort.Strings(s.Enum) })
+}
+
+// walkSchema calls fn for s and every schema nested in it.
+func walkSchema(s *jtdinfer.Schema, fn func(*jtdinfer.Schema)) {
+	fn(s)
+	if s.Elements != nil {
+		walkSchema(s.Elements, fn)
+	}
+	if s.Values != nil {
+		walkSchema(s.Values, fn)
+	}
+	for _, children := range []map[string]jtdinfer.Schema{s.Properties, s.OptionalProperties, s.Mapping} {
+		for key, child := range children {
+			walkSchema(&child, fn)
+			children[key] = child
+		}
+	}
+}
+
+// makeOptional moves the properties at path to optionalProperties. Discriminator mappings
+// are transparent: the path applies inside every variant.
+func makeOptional(s *jtdinfer.Schema, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	for tag, variant := range s.Mapping {
+		makeOptional(&variant, path)
+		s.Mapping[tag] = variant
+	}
+	key, rest := path[0], path[1:]
+	if _, err := strconv.Atoi(key); s.Elements != nil && (key == "*" || err == nil) {
+		makeOptional(s.Elements, rest)
+	}
+	if s.Values != nil {
+		makeOptional(s.Values, rest)
+	}
+	for name, child := range s.Properties {
+		if key != "*" && key != name {
+			continue
+		}
+		if len(rest) > 0 {
+			makeOptional(&child, rest)
+			s.Properties[name] = child
+			continue
+		}
+		if s.OptionalProperties == nil {
+			s.OptionalProperties = make(map[string]jtdinfer.Schema)
+		}
+		s.OptionalProperties[name] = child
+		delete(s.Properties, name)
+	}
+	for name, child := range s.OptionalProperties {
+		if (key == "*" || key == name) && len(rest) > 0 {
+			makeOptional(&child, rest)
+			s.OptionalProperties[name] = child
+		}
+	}
+}
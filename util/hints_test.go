@@ -0,0 +1,68 @@
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestInferBaselineHints(t *testing.T) {
+	bodies := []string{
+		`{"status":"active","created":"2024-01-02T03:04:05Z","user":{"id":1,"nickname":"a"},"events":[{"type":"click","x":1},{"type":"view","page":"/"}]}`,
+		`{"status":"disabled","created":"2024-02-02T03:04:05Z","user":{"id":2,"nickname":null},"events":[]}`,
+	}
+	timestamps := false
+	hints := SchemaHints{
+		Enums:          []string{"status"},
+		Discriminators: []string{"events[*].type"},
+		Optional:       []string{"user.nickname"},
+		Timestamps:     &timestamps,
+	}
+
+	schema, err := InferBaseline(bodies, hints)
+	if err != nil {
+		t.Fatalf("InferBaseline error: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(schema, &got); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	var expected map[string]interface{}
+	json.Unmarshal([]byte(`{"properties":{
+		"status":{"enum":["active","disabled"]},
+		"created":{"type":"string"},
+		"user":{"properties":{"id":{"type":"uint8"}},"optionalProperties":{"nickname":{"type":"string","nullable":true}}},
+		"events":{"elements":{"discriminator":"type","mapping":{
+			"click":{"properties":{"x":{"type":"uint8"}}},
+			"view":{"properties":{"page":{"type":"string"}}}
+		}}}
+	}}`), &expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("InferBaseline =\n%s", schema)
+	}
+
+	// Without hints, strings stay strings and timestamps are detected
+	schema, _ = InferBaseline(bodies[:1], SchemaHints{})
+	json.Unmarshal(schema, &got)
+	props := got["properties"].(map[string]interface{})
+	if !reflect.DeepEqual(props["status"], map[string]interface{}{"type": "string"}) ||
+		!reflect.DeepEqual(props["created"], map[string]interface{}{"type": "timestamp"}) {
+		t.Errorf("unexpected schema without hints:\n%s", schema)
+	}
+}
+
+func TestHintPath(t *testing.T) {
+	tests := map[string][]string{
+		"":                 {},
+		"$":                {},
+		"status":           {"status"},
+		"$.data.items.*.k": {"data", "items", "-", "k"},
+		"data.items[*].k":  {"data", "items", "-", "k"},
+		"data.items[0].k":  {"data", "items", "0", "k"},
+	}
+	for path, expected := range tests {
+		if got := hintPath(path, "-"); !reflect.DeepEqual(got, expected) {
+			t.Errorf("hintPath(%q) = %q, expected %q", path, got, expected)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxReportBody caps each body shown in the HTML report, so one large download does not bloat it.
+const maxReportBody = 64 * 1024
+
+type htmlHeader struct {
+	Name, Value string
+}
+
+type htmlResult struct {
+	TestResult
+	Filter      string // passed or failed, plus flaky; errors and skipped requests are listed as failed
+	Method      string
+	URL         string
+	ReqHeaders  []htmlHeader
+	ReqBody     string
+	RespHeaders []htmlHeader
+	RespBody    string
+	Checks      []AssertionResult // Every assertion of the expect block
+	LoginStatus int               // Status that triggered an automatic login, if any
+}
+
+type htmlReport struct {
+	TestReport
+	Title                                  string
+	Elapsed                                string
+	Passed, Failed, Errors, Skipped, Flaky int
+	NotPassed                              int // Failed, errors and skipped, shown by the failed filter
+	Items                                  []htmlResult
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms":  func(r TestResult) int64 { return r.Duration.Milliseconds() },
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font: 14px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 1100px; padding: 0 1em; color: #1f2328; }
+h1 { font-size: 1.5em; margin-bottom: 0.2em; }
+.meta { color: #59636e; margin-bottom: 1em; }
+.filters button { font: inherit; padding: 0.3em 0.9em; margin-right: 0.3em; border: 1px solid #d1d9e0; border-radius: 6px; background: #f6f8fa; cursor: pointer; }
+.filters button.active { background: #1f2328; color: #fff; border-color: #1f2328; }
+details.result { border: 1px solid #d1d9e0; border-left-width: 5px; border-radius: 6px; margin: 0.6em 0; }
+details.result[data-outcome="passed"] { border-left-color: #1a7f37; }
+details.result[data-outcome="failed"] { border-left-color: #d1242f; }
+details.result[data-outcome="error"] { border-left-color: #9a6700; }
+details.result[data-outcome="skipped"] { border-left-color: #d1d9e0; }
+summary { padding: 0.5em 0.8em; cursor: pointer; display: flex; gap: 1em; align-items: baseline; }
+summary .name { font-weight: 600; flex: 1; font-family: ui-monospace, Menlo, monospace; }
+summary .outcome { text-transform: uppercase; font-size: 0.8em; font-weight: 600; width: 4.5em; }
+[data-outcome="passed"] .outcome { color: #1a7f37; }
+[data-outcome="failed"] .outcome { color: #d1242f; }
+[data-outcome="error"] .outcome { color: #9a6700; }
+[data-outcome="skipped"] .outcome { color: #59636e; }
+summary .timing, summary .status { color: #59636e; }
+summary .flaky { font-size: 0.8em; font-weight: 600; color: #9a6700; border: 1px solid #d4a72c; border-radius: 1em; padding: 0 0.6em; }
+.body { padding: 0 1em 1em; }
+.message { font-weight: 600; }
+h3 { font-size: 1em; margin: 1em 0 0.3em; }
+ul.errors { margin: 0.3em 0; padding-left: 1.4em; font-family: ui-monospace, Menlo, monospace; font-size: 0.9em; }
+ul.errors li.ok { color: #1a7f37; }
+ul.errors li.fail { color: #d1242f; }
+table { border-collapse: collapse; font-family: ui-monospace, Menlo, monospace; font-size: 0.85em; }
+td { padding: 0.1em 1em 0.1em 0; vertical-align: top; word-break: break-all; }
+td:first-child { color: #59636e; white-space: nowrap; }
+pre { background: #f6f8fa; padding: 0.7em; border-radius: 6px; overflow: auto; max-height: 30em; font-size: 0.85em; }
+.empty { color: #59636e; font-style: italic; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="meta">Started {{.StartedAt.Format "2006-01-02 15:04:05 MST"}} · {{.Elapsed}} · {{len .Results}} requests: {{.Passed}} passed, {{.Failed}} failed, {{.Errors}} errors, {{.Skipped}} skipped{{if .Flaky}}, {{.Flaky}} flaky{{end}}</div>
+<div class="filters">
+<button data-filter="all" class="active">All ({{len .Results}})</button>
+<button data-filter="passed">Passed ({{.Passed}})</button>
+<button data-filter="failed">Failed ({{.NotPassed}})</button>
+{{if .Flaky}}<button data-filter="flaky">Flaky ({{.Flaky}})</button>{{end}}
+</div>
+{{range .Items}}
+<details class="result" data-outcome="{{.Outcome}}" data-filter="{{.Filter}}"{{if or (eq .Outcome "failed") (eq .Outcome "error")}} open{{end}}>
+<summary><span class="outcome">{{.Outcome}}</span><span class="name">{{.Name}}</span>{{if .Flaky}}<span class="flaky">flaky</span>{{end}}{{if .StatusCode}}<span class="status">HTTP {{.StatusCode}}</span>{{end}}<span class="timing">{{ms .TestResult}} ms</span></summary>
+<div class="body">
+{{if .Message}}<p class="message">{{.Message}}</p>{{end}}
+{{if .Retried}}<h3>Earlier attempts</h3>
+<ul class="errors">{{range $i, $m := .Retried}}<li class="fail">Attempt {{inc $i}}: {{$m}}</li>{{end}}</ul>{{end}}
+{{if .SchemaErrors}}<h3>Schema errors</h3>
+<ul class="errors">{{range .SchemaErrors}}<li class="fail">{{.String}}</li>{{end}}</ul>{{end}}
+{{if .Checks}}<h3>Assertions</h3>
+<ul class="errors">{{range .Checks}}{{if .Passed}}<li class="ok">✓ {{.Name}}</li>{{else}}<li class="fail">✗ {{.Name}}: {{.Message}}</li>{{end}}{{end}}</ul>{{end}}
+{{if .Method}}
+{{if .LoginStatus}}<p>Replayed after an automatic login triggered by HTTP {{.LoginStatus}}.</p>{{end}}
+<h3>Request</h3>
+<p><code>{{.Method}} {{.URL}}</code></p>
+{{if .ReqHeaders}}<table>{{range .ReqHeaders}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>{{end}}</table>{{end}}
+{{if .ReqBody}}<pre>{{.ReqBody}}</pre>{{end}}
+<h3>Response</h3>
+{{if .RespHeaders}}<table>{{range .RespHeaders}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>{{end}}</table>{{end}}
+{{if .RespBody}}<pre>{{.RespBody}}</pre>{{else}}<p class="empty">Empty body</p>{{end}}
+{{end}}
+</div>
+</details>
+{{end}}
+<script>
+document.querySelectorAll('.filters button').forEach(function (button) {
+  button.addEventListener('click', function () {
+    document.querySelectorAll('.filters button').forEach(function (b) { b.classList.toggle('active', b === button); });
+    document.querySelectorAll('details.result').forEach(function (result) {
+      result.hidden = button.dataset.filter !== 'all' && result.dataset.filter.split(' ').indexOf(button.dataset.filter) === -1;
+    });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// writeHTMLReport writes a single static HTML page with the request and response of every
+// test, which can be filtered by outcome. Bodies come from TestResult.Response, already redacted.
+func writeHTMLReport(w io.Writer, report TestReport) error {
+	page := htmlReport{
+		TestReport: report,
+		Title:      "lpost test report",
+		Elapsed:    report.Duration.Round(time.Millisecond).String(),
+		Passed:     report.count(OutcomePassed),
+		Failed:     report.count(OutcomeFailed),
+		Errors:     report.count(OutcomeError),
+		Skipped:    report.count(OutcomeSkipped),
+		Flaky:      report.flaky(),
+	}
+	page.NotPassed = page.Failed + page.Errors + page.Skipped
+	if report.Env != "" {
+		page.Title += " (" + report.Env + ")"
+	}
+	for _, result := range report.Results {
+		item := htmlResult{TestResult: result, Filter: "failed"}
+		if result.Outcome == OutcomePassed {
+			item.Filter = "passed"
+		}
+		if result.Flaky() {
+			item.Filter += " flaky"
+		}
+		if resp := result.Response; resp != nil {
+			item.Method, item.URL = resp.ReqMethod, resp.ReqURL
+			for name, value := range resp.ReqHeaders {
+				item.ReqHeaders = append(item.ReqHeaders, htmlHeader{name, value})
+			}
+			for name, values := range resp.RespHeaders {
+				for _, value := range values {
+					item.RespHeaders = append(item.RespHeaders, htmlHeader{name, value})
+				}
+			}
+			sortHeaders(item.ReqHeaders)
+			sortHeaders(item.RespHeaders)
+			item.ReqBody = reportBody(resp.ReqBody)
+			item.RespBody = reportBody(resp.RespBody)
+			item.Checks = resp.Assertions
+			if resp.AuthRefresh != nil {
+				item.LoginStatus = resp.AuthRefresh.TriggerStatus
+			}
+		}
+		page.Items = append(page.Items, item)
+	}
+	return htmlReportTemplate.Execute(w, page)
+}
+
+func sortHeaders(headers []htmlHeader) {
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+}
+
+// reportBody pretty prints a JSON body and truncates long ones.
+func reportBody(body string) string {
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, []byte(body), "", "  "); err == nil {
+		body = pretty.String()
+	}
+	if len(body) > maxReportBody {
+		body = fmt.Sprintf("%s\n… truncated, %d of %d bytes shown", strings.ToValidUTF8(body[:maxReportBody], ""), maxReportBody, len(body))
+	}
+	return body
+}
@@ -10,11 +10,9 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-	"slices"
 	"strings"
 	"time"
 
-	jtdinfer "github.com/bombsimon/jtd-infer-go"
 	"github.com/fatih/color"
 	"github.com/jedib0t/go-pretty/v6/progress"
 	"github.com/jedib0t/go-pretty/v6/text"
@@ -48,8 +46,11 @@ func readRequestDefinition(filePath string) (RequestDefinition, error) {
 		return RequestDefinition{}, fmt.Errorf("error parsing %s: %v", filePath, err)
 	}
 
-	// Set Method strictly from filename
-	req.Method = strings.TrimSuffix(filepath.Base(filePath), ".yaml")
+	// Set Method strictly from filename, without the variant name
+	req.Method, _, err = SplitRequestName(strings.TrimSuffix(filepath.Base(filePath), ".yaml"))
+	if err != nil {
+		return RequestDefinition{}, fmt.Errorf("invalid request file %s: %v", filePath, err)
+	}
 
 	// Set URL from directory path and BASE_URL from config
 	if req.URL == "" {
@@ -57,7 +58,7 @@ func readRequestDefinition(filePath string) (RequestDefinition, error) {
 		if err != nil {
 			return RequestDefinition{}, fmt.Errorf("error loading env: %v", err)
 		}
-		baseURL, ok := env.Vars["BASE_URL"]
+		baseURL, ok := env.Resolved["BASE_URL"]
 		if !ok {
 			return RequestDefinition{}, fmt.Errorf("BASE_URL not found. Please set it in config.yaml")
 		}
@@ -65,11 +66,13 @@ func readRequestDefinition(filePath string) (RequestDefinition, error) {
 		if err != nil {
 			return RequestDefinition{}, fmt.Errorf("error getting relative path for %s: %v", filePath, err)
 		}
-		urlPath := strings.TrimSuffix(relPath, filepath.Ext(relPath))
+		// The file name is the method, so the URL path is the directory.
+		// Directories named {id} or :id become path parameters.
+		urlPath := filepath.Dir(relPath)
 		if urlPath == "." {
 			urlPath = ""
-		} else {
-			urlPath = strings.ReplaceAll(urlPath, string(os.PathSeparator), "/")
+		} else if urlPath, err = urlPathTemplate(urlPath); err != nil {
+			return RequestDefinition{}, fmt.Errorf("error deriving the URL of %s: %v", filePath, err)
 		}
 		req.URL = baseURL + "/" + urlPath
 	}
@@ -78,112 +81,85 @@ func readRequestDefinition(filePath string) (RequestDefinition, error) {
 }
 
 func processResponse(reqDef RequestDefinition, resp Response) error {
-	if len(reqDef.SetEnv) > 0 {
-		for varName, source := range reqDef.SetEnv {
-			var value string
-			if source.Header != "" {
-				if val, ok := resp.RespHeaders[source.Header]; ok && len(val) > 0 {
-					value = val[0]
-				}
-			} else if source.Body != "" {
-				var data map[string]interface{}
-				if err := json.Unmarshal([]byte(resp.RespBody), &data); err == nil {
-					if val, ok := data[source.Body]; ok {
-						value = fmt.Sprintf("%v", val)
-					}
-				}
-			}
-			if value != "" {
-				if err := SetEnvVar(varName, value); err != nil {
-					return fmt.Errorf("error setting env var %s: %v", varName, err)
-				}
-			}
+	for varName, source := range reqDef.SetEnv {
+		value, err := extractValue(source, resp)
+		if err != nil {
+			return fmt.Errorf("error extracting %s: %v", varName, err)
 		}
-	}
-
-	if setCookies, ok := resp.RespHeaders["Set-Cookie"]; ok && len(setCookies) > 0 {
-		for _, cookie := range setCookies {
-			parts := strings.SplitN(cookie, ";", 2)
-			if len(parts) > 0 {
-				kv := strings.SplitN(parts[0], "=", 2)
-				if len(kv) == 2 {
-					name := strings.TrimSpace(kv[0])
-					value := strings.TrimSpace(kv[1])
-					if err := SetCookie(name, value); err != nil {
-						return fmt.Errorf("error setting cookie %s: %v", name, err)
-					}
-				}
+		if value == "" {
+			continue
+		}
+		if source.Persist {
+			if err := SetEnvVar(varName, value); err != nil {
+				return fmt.Errorf("error setting env var %s: %v", varName, err)
 			}
+		} else if err := SetSessionVar(varName, value); err != nil {
+			return fmt.Errorf("error setting session var %s: %v", varName, err)
 		}
 	}
 
 	return nil
 }
 
-func inferSchema(resp Response, filePath string) {
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 && strings.TrimSpace(resp.RespBody) != "" {
-		var doc interface{}
-		if err := json.Unmarshal([]byte(resp.RespBody), &doc); err == nil {
-			schema := jtdinfer.InferStrings([]string{resp.RespBody}, jtdinfer.WithoutHints()).IntoSchema()
-			dirPath := filepath.Dir(filePath)
-			method := strings.TrimSuffix(filepath.Base(filePath), ".yaml")
-			schemaPath := filepath.Join(dirPath, method+".jtd.json")
-			schemaBytes, err := json.MarshalIndent(schema, "", "  ")
-			if err == nil {
-				os.MkdirAll(dirPath, 0755)
-				os.WriteFile(schemaPath, schemaBytes, 0644)
-			}
-		}
-	}
-}
-
-func executeHTTPRequest(reqDef RequestDefinition, filePath string, inferSchema bool, isRetry bool) (Response, error) {
+func executeHTTPRequest(reqDef RequestDefinition, filePath string, opts RequestOptions, isRetry bool) (Response, error) {
 	env, err := LoadEnv()
 	if err != nil {
 		return Response{}, fmt.Errorf("error loading env: %v", err)
 	}
-	cookies, err := LoadCookies()
+	if env.Login != nil && env.Login.OAuth2 != nil {
+		fetched, err := EnsureOAuthToken(env, "")
+		if err != nil {
+			return Response{}, fmt.Errorf("error fetching oauth2 token: %v", err)
+		}
+		if fetched != nil {
+			if env, err = LoadEnv(); err != nil {
+				return Response{}, fmt.Errorf("error loading env: %v", err)
+			}
+		}
+	}
+	jar, err := LoadJar(env.Name)
 	if err != nil {
 		return Response{}, fmt.Errorf("error loading cookies: %v", err)
 	}
 
-	finalURL, err := replacePlaceholders(reqDef.URL, env.Vars)
+	original := reqDef
+	if reqDef.Auth == nil {
+		reqDef.Auth = env.Auth
+	}
+	vars := env.Resolved
+	if len(opts.Params) > 0 {
+		vars = make(map[string]string, len(env.Resolved)+len(opts.Params))
+		for key, value := range env.Resolved {
+			vars[key] = value
+		}
+		for key, value := range opts.Params {
+			vars[key] = value
+		}
+	}
+	reqDef, err = renderRequest(reqDef, vars, env.StrictPlaceholders() && !opts.Lenient)
 	if err != nil {
-		return Response{}, fmt.Errorf("error replacing placeholders in URL: %v", err)
+		return Response{}, err
+	}
+	if env.Signing != nil && reqDef.Auth != nil && reqDef.Auth.Type == AuthDigest && env.Signing.setsAuthorization() {
+		return Response{}, fmt.Errorf("auth: digest cannot be combined with signing: %s, which sets the Authorization header too", env.Signing.Type)
 	}
+	finalURL := reqDef.URL
 
 	if !strings.HasPrefix(finalURL, "http://") && !strings.HasPrefix(finalURL, "https://") {
 		return Response{}, fmt.Errorf("invalid URL after placeholder replacement: %s", finalURL)
 	}
 
-	for key, value := range reqDef.Headers {
-		reqDef.Headers[key], err = replacePlaceholders(value, env.Vars)
-		if err != nil {
-			return Response{}, fmt.Errorf("error replacing placeholders in header %s: %v", key, err)
-		}
-	}
-
-	var body io.Reader
 	contentType := reqDef.Headers["Content-Type"]
 	var reqBody string
 
 	switch contentType {
 	case "application/json", "":
 		if len(reqDef.Body.Json) > 0 {
-			for key, value := range reqDef.Body.Json {
-				if strVal, ok := value.(string); ok {
-					reqDef.Body.Json[key], err = replacePlaceholders(strVal, env.Vars)
-					if err != nil {
-						return Response{}, fmt.Errorf("error replacing placeholders in JSON body %s: %v", key, err)
-					}
-				}
-			}
 			bodyBytes, err := json.Marshal(reqDef.Body.Json)
 			if err != nil {
 				return Response{}, fmt.Errorf("error marshaling JSON body: %v", err)
 			}
 			reqBody = string(bodyBytes)
-			body = strings.NewReader(reqBody)
 			if contentType == "" {
 				contentType = "application/json"
 			}
@@ -195,7 +171,6 @@ func executeHTTPRequest(reqDef RequestDefinition, filePath string, inferSchema b
 				data.Set(k, v)
 			}
 			reqBody = data.Encode()
-			body = strings.NewReader(reqBody)
 		}
 	case "multipart/form-data":
 		if len(reqDef.Body.Form.Fields) > 0 || len(reqDef.Body.Form.Files) > 0 {
@@ -225,13 +200,11 @@ func executeHTTPRequest(reqDef RequestDefinition, filePath string, inferSchema b
 				return Response{}, fmt.Errorf("error closing form writer: %v", err)
 			}
 			reqBody = bodyBuffer.String()
-			body = bodyBuffer
 			contentType = writer.FormDataContentType()
 		}
 	case "text/plain":
 		if reqDef.Body.Text != "" {
 			reqBody = reqDef.Body.Text
-			body = strings.NewReader(reqBody)
 		}
 	default:
 		if len(reqDef.Body.Json) > 0 || len(reqDef.Body.FormUrlEncoded) > 0 || len(reqDef.Body.Form.Fields) > 0 || len(reqDef.Body.Form.Files) > 0 || reqDef.Body.Text != "" {
@@ -241,64 +214,193 @@ func executeHTTPRequest(reqDef RequestDefinition, filePath string, inferSchema b
 
 	client := &http.Client{
 		Timeout: time.Duration(env.Timeout) * time.Second,
+		Jar:     jar,
 	}
-	httpReq, err := http.NewRequest(reqDef.Method, finalURL, body)
-	if err != nil {
-		return Response{}, fmt.Errorf("error creating request: %v", err)
-	}
-
-	for key, value := range reqDef.Headers {
-		httpReq.Header.Set(key, value)
-	}
-	if contentType != "" {
-		httpReq.Header.Set("Content-Type", contentType)
-	}
-
-	if len(cookies) > 0 {
-		cookieHeader := ""
-		for name, value := range cookies {
-			if cookieHeader != "" {
-				cookieHeader += "; "
+	// newRequest builds a fresh request so it can be resent, e.g. to answer a digest challenge.
+	// authorization is set before signing, so the signature covers the request as sent.
+	newRequest := func(authorization string) (*http.Request, error) {
+		var body io.Reader
+		if reqBody != "" {
+			body = strings.NewReader(reqBody)
+		}
+		httpReq, err := http.NewRequest(reqDef.Method, finalURL, body)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %v", err)
+		}
+		for key, value := range reqDef.Headers {
+			httpReq.Header.Set(key, value)
+		}
+		if contentType != "" {
+			httpReq.Header.Set("Content-Type", contentType)
+		}
+		if err := applyAuth(httpReq, reqDef.Auth); err != nil {
+			return nil, fmt.Errorf("error applying auth: %v", err)
+		}
+		if authorization != "" {
+			httpReq.Header.Set("Authorization", authorization)
+		}
+		if env.Signing != nil {
+			if err := signRequest(httpReq, reqBody, env.Signing, vars, time.Now()); err != nil {
+				return nil, fmt.Errorf("error signing request: %v", err)
 			}
-			cookieHeader += fmt.Sprintf("%s=%s", name, value)
 		}
-		httpReq.Header.Set("Cookie", cookieHeader)
+		return httpReq, nil
 	}
 
-	resp, err := client.Do(httpReq)
+	httpReq, err := newRequest("")
 	if err != nil {
-		return Response{}, fmt.Errorf("error executing request: %v", err)
+		return Response{}, err
 	}
-	defer resp.Body.Close()
 
-	respBodyBytes, err := io.ReadAll(resp.Body)
+	start := time.Now()
+	resp, respBodyBytes, err := doRequest(client, httpReq)
 	if err != nil {
-		return Response{}, fmt.Errorf("error reading response: %v", err)
+		return Response{}, err
 	}
+	if challenge := digestChallenge(resp); challenge != "" && reqDef.Auth != nil && reqDef.Auth.Type == AuthDigest && reqDef.Headers["Authorization"] == "" {
+		cnonce, err := randomHex(16)
+		if err != nil {
+			return Response{}, fmt.Errorf("error generating digest cnonce: %v", err)
+		}
+		authorization, err := digestAuthorization(challenge, reqDef.Auth, httpReq, cnonce)
+		if err != nil {
+			return Response{}, fmt.Errorf("error answering digest challenge: %v", err)
+		}
+		if httpReq, err = newRequest(authorization); err != nil {
+			return Response{}, err
+		}
+		if resp, respBodyBytes, err = doRequest(client, httpReq); err != nil {
+			return Response{}, err
+		}
+	}
+	duration := time.Since(start)
 	respBody := string(respBodyBytes)
 
+	if err := jar.Save(); err != nil {
+		return Response{}, fmt.Errorf("error saving cookies: %v", err)
+	}
+
+	sentHeaders := make(map[string]string, len(httpReq.Header))
+	for key := range httpReq.Header {
+		sentHeaders[key] = httpReq.Header.Get(key)
+	}
+
 	response := Response{
-		ReqURL:      finalURL,
-		ReqHeaders:  reqDef.Headers,
+		ReqMethod:   httpReq.Method,
+		ReqURL:      httpReq.URL.String(),
+		ReqHeaders:  sentHeaders,
 		ReqBody:     reqBody,
 		StatusCode:  resp.StatusCode,
 		RespHeaders: resp.Header,
 		RespBody:    respBody,
+		Duration:    duration,
 	}
 
-	if env.Login != nil && !isRetry {
-		if slices.Contains(env.Login.TriggeredBy, response.StatusCode) {
-			loginReqDef, err := readRequestDefinition(filepath.Join(RequestsDir, env.Login.Request))
-			if err != nil {
-				return executeHTTPRequest(loginReqDef, filePath, inferSchema, true)
-			}
+	if env.Login != nil && env.Login.OAuth2 != nil && !isRetry && env.Login.Triggers(response.StatusCode) {
+		return refreshOAuthAndRetry(original, filePath, opts, response, env)
+	}
+	if env.Login != nil && env.Login.Request != "" && !isRetry && env.Login.Triggers(response.StatusCode) {
+		loginPath := RequestFilePath(env.Login.Request)
+		if filepath.Clean(loginPath) == filepath.Clean(filePath) {
+			return response, nil // The login request itself was rejected
 		}
+		return refreshAuthAndRetry(original, filePath, opts, response, loginPath)
 	}
 
 	return response, nil
 }
 
-func HandleRequest(filePath string, verbose, toInferSchema bool) (Response, error) {
+// doRequest sends req and reads the whole response body.
+func doRequest(client *http.Client, req *http.Request) (*http.Response, []byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error executing request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading response: %v", err)
+	}
+	return resp, body, nil
+}
+
+// digestChallenge returns the Digest WWW-Authenticate challenge of a 401 response, if any.
+func digestChallenge(resp *http.Response) string {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return ""
+	}
+	for _, challenge := range resp.Header.Values("WWW-Authenticate") {
+		if len(challenge) > 7 && strings.EqualFold(challenge[:7], "Digest ") {
+			return challenge
+		}
+	}
+	return ""
+}
+
+// refreshAuthAndRetry runs the configured login request, applies its set-env-var captures
+// (cookies are already stored by the jar) and replays the original request once.
+func refreshAuthAndRetry(original RequestDefinition, filePath string, opts RequestOptions, first Response, loginPath string) (Response, error) {
+	loginReqDef, err := readRequestDefinition(loginPath)
+	if err != nil {
+		return first, fmt.Errorf("error reading login request: %v", err)
+	}
+	loginResp, err := executeHTTPRequest(loginReqDef, loginPath, opts, true)
+	if err != nil {
+		return first, fmt.Errorf("error executing login request %s: %v", loginPath, err)
+	}
+	if loginResp.StatusCode < 200 || loginResp.StatusCode >= 300 {
+		return first, fmt.Errorf("login request %s failed with status %d", loginPath, loginResp.StatusCode)
+	}
+	if err := processResponse(loginReqDef, loginResp); err != nil {
+		return first, fmt.Errorf("error processing login response: %v", err)
+	}
+
+	retried, err := executeHTTPRequest(original, filePath, opts, true)
+	if err != nil {
+		return first, fmt.Errorf("error retrying request after login: %v", err)
+	}
+	retried.AuthRefresh = &AuthRefresh{
+		TriggerStatus: first.StatusCode,
+		LoginRequest:  loginPath,
+		LoginResponse: loginResp,
+	}
+	return retried, nil
+}
+
+// refreshOAuthAndRetry fetches a new OAuth2 token to replace the rejected one and replays the original request once.
+func refreshOAuthAndRetry(original RequestDefinition, filePath string, opts RequestOptions, first Response, env Env) (Response, error) {
+	oauth := env.Login.OAuth2
+	tokenResp, err := EnsureOAuthToken(env, env.Resolved[oauth.tokenVar()])
+	if err != nil {
+		return first, fmt.Errorf("error fetching oauth2 token: %v", err)
+	}
+
+	retried, err := executeHTTPRequest(original, filePath, opts, true)
+	if err != nil {
+		return first, fmt.Errorf("error retrying request after token refresh: %v", err)
+	}
+	if tokenResp != nil { // Nil when a concurrent request already replaced the token
+		retried.AuthRefresh = &AuthRefresh{
+			TriggerStatus: first.StatusCode,
+			LoginRequest:  tokenResp.ReqURL,
+			LoginResponse: *tokenResp,
+		}
+	}
+	return retried, nil
+}
+
+// RequestFilePath converts a request reference such as /auth/login/POST, auth/login/POST
+// or auth/login/POST.yaml into the path of its YAML file under the requests directory.
+func RequestFilePath(ref string) string {
+	ref = strings.TrimPrefix(filepath.ToSlash(ref), "/")
+	ref = strings.TrimPrefix(ref, filepath.ToSlash(RequestsDir)+"/")
+	if !strings.HasSuffix(ref, ".yaml") {
+		ref += ".yaml"
+	}
+	return filepath.Join(RequestsDir, filepath.FromSlash(ref))
+}
+
+func HandleRequest(filePath string, opts RequestOptions) (Response, error) {
 	reqDef, err := readRequestDefinition(filePath)
 	if err != nil {
 		return Response{}, err
@@ -326,7 +428,7 @@ func HandleRequest(filePath string, verbose, toInferSchema bool) (Response, erro
 
 	go pw.Render()
 
-	resp, err := executeHTTPRequest(reqDef, filePath, toInferSchema, false)
+	resp, err := executeHTTPRequest(reqDef, filePath, opts, false)
 	if err != nil {
 		pw.Stop()
 		tracker.MarkAsErrored()
@@ -339,6 +441,8 @@ func HandleRequest(filePath string, verbose, toInferSchema bool) (Response, erro
 		return Response{}, err
 	}
 
+	resp.Assertions = evaluateExpectations(reqDef.Expect, resp)
+
 	var statusColor text.Color
 	switch {
 	case resp.StatusCode >= 200 && resp.StatusCode < 300:
@@ -362,8 +466,8 @@ func HandleRequest(filePath string, verbose, toInferSchema bool) (Response, erro
 		time.Sleep(time.Millisecond * 10)
 	}
 
-	if toInferSchema {
-		inferSchema(resp, filePath)
+	if err := recordSample(filePath, resp, reqDef.Schema); err != nil {
+		fmt.Printf("Warning: could not record response sample: %v\n", err)
 	}
 
 	reqContentType := ""
@@ -378,7 +482,14 @@ func HandleRequest(filePath string, verbose, toInferSchema bool) (Response, erro
 	respBodyDisplay := formatJSON(resp.RespBody, respContentType)
 
 	fmt.Println("----------------------------------------")
-	if verbose {
+	if opts.Verbose && resp.AuthRefresh != nil {
+		refresh := resp.AuthRefresh
+		fmt.Println(color.CyanString("Auth refresh:"))
+		fmt.Printf("    %s %s returned %d\n", reqDef.Method, resp.ReqURL, refresh.TriggerStatus)
+		fmt.Printf("    Login %s -> %d (%dms)\n", refresh.LoginRequest, refresh.LoginResponse.StatusCode, refresh.LoginResponse.Duration.Milliseconds())
+		fmt.Printf("    Retried -> %d\n", resp.StatusCode)
+	}
+	if opts.Verbose {
 		fmt.Println(color.CyanString("Request:"))
 		fmt.Println(color.HiBlueString("  Headers:"))
 		if resp.ReqHeaders == nil || len(resp.ReqHeaders) == 0 {
@@ -410,6 +521,21 @@ func HandleRequest(filePath string, verbose, toInferSchema bool) (Response, erro
 	} else {
 		fmt.Println(color.HiYellowString("    <Empty>"))
 	}
+	printAssertions(resp.Assertions)
 
 	return resp, nil
 }
+
+func printAssertions(assertions []AssertionResult) {
+	if len(assertions) == 0 {
+		return
+	}
+	fmt.Println(color.CyanString("Assertions:"))
+	for _, a := range assertions {
+		if a.Passed {
+			fmt.Printf("  %s %s\n", color.GreenString("✓"), a.Name)
+		} else {
+			fmt.Printf("  %s %s: %s\n", color.RedString("✗"), a.Name, a.Message)
+		}
+	}
+}
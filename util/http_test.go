@@ -1,34 +1,181 @@
 package util
 
-import "testing"
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
-func TestReplacePlaceholdersWithQueryParams(t *testing.T) {
-	vars := map[string]string{
-		"BASE_URL": "https://api.example.com",
-		"CAT":      "electronics",
+func TestExtractValue(t *testing.T) {
+	resp := Response{
+		StatusCode: 201,
+		RespHeaders: map[string][]string{
+			"X-Trace":    {"t-1"},
+			"Set-Cookie": {"sid=abc; Path=/; HttpOnly"},
+		},
+		RespBody: `{"data":{"session":{"token":"jwt"}},"items":[{"id":1},{"id":2}],"jwt-token":"legacy","user":{"id":1234567890123456789,"score":0.5}}`,
 	}
 
 	tests := []struct {
-		input    string
+		source   SetEnvSource
 		expected string
 	}{
-		{
-			input:    "{BASE_URL}/products/search?x=x",
-			expected: "https://api.example.com/products/search?x=x",
-		},
-		{
-			input:    "{BASE_URL}/products/search?category={CAT}&limit=10",
-			expected: "https://api.example.com/products/search?category=electronics&limit=10",
-		},
+		{SetEnvSource{Header: "x-trace"}, "t-1"},
+		{SetEnvSource{Body: "data.session.token"}, "jwt"},
+		{SetEnvSource{Body: "$.items[1].id"}, "2"},
+		{SetEnvSource{Body: "items[-1].id"}, "2"},
+		{SetEnvSource{Body: "$.items[*].id"}, "[1,2]"},
+		{SetEnvSource{Body: "$..token"}, `["jwt"]`},
+		{SetEnvSource{Body: "jwt-token"}, "legacy"},
+		{SetEnvSource{Body: "user.id"}, "1234567890123456789"}, // Above 2^53, so a float64 would round it
+		{SetEnvSource{Body: "user.score"}, "0.5"},
+		{SetEnvSource{Body: "missing.path"}, ""},
+		{SetEnvSource{Status: true}, "201"},
+		{SetEnvSource{Cookie: "sid"}, "abc"},
+		{SetEnvSource{Regex: `"token":"([^"]+)"`}, "jwt"},
 	}
 
 	for _, tt := range tests {
-		result, err := replacePlaceholders(tt.input, vars)
+		result, err := extractValue(tt.source, resp)
 		if err != nil {
-			t.Errorf("replacePlaceholders(%q) error: %v", tt.input, err)
+			t.Errorf("extractValue(%+v) error: %v", tt.source, err)
 		}
 		if result != tt.expected {
-			t.Errorf("replacePlaceholders(%q) = %q, expected %q", tt.input, result, tt.expected)
+			t.Errorf("extractValue(%+v) = %q, expected %q", tt.source, result, tt.expected)
+		}
+	}
+}
+
+// writeRequests creates request files under the requests directory, keyed by their relative path.
+func writeRequests(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(RequestsDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRefreshAuthAndRetry(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	hits := map[string]int{}
+	loginStatus := http.StatusOK
+	validToken := "fresh"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/auth/login":
+			w.WriteHeader(loginStatus)
+			fmt.Fprint(w, `{"token":"fresh"}`)
+		case "/users":
+			if r.Header.Get("Authorization") != "Bearer "+validToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `[]`)
+		}
+	}))
+	defer server.Close()
+
+	writeTestConfig(t, &Config{Env: "dev", Envs: map[string]Env{"dev": {
+		Vars:  map[string]string{"BASE_URL": server.URL, "TOKEN": "stale"},
+		Login: &LoginConfig{Request: "auth/login/POST"},
+	}}})
+	writeRequests(t, map[string]string{
+		"users/GET.yaml":       "url: \"{BASE_URL}/users\"\nheaders:\n  Authorization: \"Bearer {TOKEN}\"\n",
+		"auth/login/POST.yaml": "url: \"{BASE_URL}/auth/login\"\nset-env-var:\n  TOKEN:\n    body: token\n",
+	})
+	run := func(ref string) (Response, error) {
+		t.Helper()
+		path := RequestFilePath(ref)
+		reqDef, err := readRequestDefinition(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return executeHTTPRequest(reqDef, path, RequestOptions{}, false)
+	}
+
+	// A 401 logs in, applies the captured token and replays the request once
+	resp, err := run("users/GET")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	if resp.StatusCode != 200 || resp.ReqHeaders["Authorization"] != "Bearer fresh" {
+		t.Errorf("replayed request = %d with %q, expected 200 with the fresh token", resp.StatusCode, resp.ReqHeaders["Authorization"])
+	}
+	if resp.AuthRefresh == nil || resp.AuthRefresh.TriggerStatus != 401 || resp.AuthRefresh.LoginResponse.StatusCode != 200 {
+		t.Errorf("AuthRefresh = %+v", resp.AuthRefresh)
+	}
+	if vars, _ := SessionVars("dev"); vars["TOKEN"] != "fresh" {
+		t.Errorf("session TOKEN = %q, expected fresh", vars["TOKEN"])
+	}
+	if hits["/auth/login"] != 1 || hits["/users"] != 2 {
+		t.Errorf("hits = %v, expected 1 login and 2 users requests", hits)
+	}
+
+	// A replay that is rejected again is not retried a second time
+	clear(hits)
+	validToken = "never"
+	if resp, err := run("users/GET"); err != nil || resp.StatusCode != 401 {
+		t.Errorf("rejected replay = %d, %v; expected 401", resp.StatusCode, err)
+	}
+	if hits["/auth/login"] != 1 || hits["/users"] != 2 {
+		t.Errorf("hits = %v, expected 1 login and 2 users requests", hits)
+	}
+
+	// A login request that is rejected fails without logging in again
+	clear(hits)
+	loginStatus = http.StatusUnauthorized
+	if _, err := run("users/GET"); err == nil || !strings.Contains(err.Error(), "failed with status 401") {
+		t.Errorf("expected the rejected login to fail, got %v", err)
+	}
+	if resp, err := run("auth/login/POST"); err != nil || resp.StatusCode != 401 || resp.AuthRefresh != nil {
+		t.Errorf("login request itself = %d, %v; expected a plain 401", resp.StatusCode, err)
+	}
+	if hits["/auth/login"] != 2 || hits["/users"] != 1 {
+		t.Errorf("hits = %v, expected 2 login and 1 users requests", hits)
+	}
+}
+
+func TestReadRequestDefinitionURL(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestConfig(t, &Config{Env: "dev", Envs: map[string]Env{"dev": {Vars: map[string]string{"BASE_URL": "http://api"}}}})
+	writeRequests(t, map[string]string{
+		"GET.yaml":                   "",
+		"users/GET.yaml":             "",
+		"users/POST@admin.yaml":      "",
+		"users/{id}/orders/GET.yaml": "",
+		"login/POST.yaml":            "url: \"{BASE_URL}/auth/login\"\n",
+	})
+
+	tests := []struct {
+		file     string
+		method   string
+		expected string
+	}{
+		{"GET.yaml", "GET", "http://api/"},
+		{"users/GET.yaml", "GET", "http://api/users"},
+		{"users/POST@admin.yaml", "POST", "http://api/users"},
+		{"users/{id}/orders/GET.yaml", "GET", "http://api/users/{id|pathescape}/orders"},
+		{"login/POST.yaml", "POST", "{BASE_URL}/auth/login"},
+	}
+	for _, tt := range tests {
+		req, err := readRequestDefinition(RequestFilePath(tt.file))
+		if err != nil {
+			t.Errorf("readRequestDefinition(%s) error: %v", tt.file, err)
+			continue
+		}
+		if req.Method != tt.method || req.URL != tt.expected {
+			t.Errorf("readRequestDefinition(%s) = %s %s, expected %s %s", tt.file, req.Method, req.URL, tt.method, tt.expected)
 		}
 	}
 }
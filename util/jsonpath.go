@@ -0,0 +1,192 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is a single step in a JSONPath expression.
+type pathSegment struct {
+	key       string
+	index     int
+	isIndex   bool
+	wildcard  bool // .* or [*]: every child of an object or array
+	recursive bool // ..key: key at any depth below the current node
+}
+
+// parseJSONPath parses expressions like $.data.items[0].id, data.items[-1]['id'],
+// $.items[*].id or $..id. The leading "$" is optional.
+func parseJSONPath(path string) ([]pathSegment, error) {
+	p := strings.TrimSpace(path)
+	p = strings.TrimPrefix(p, "$")
+	var segments []pathSegment
+	readKey := func(i int) (string, int) {
+		start := i
+		for i < len(p) && p[i] != '.' && p[i] != '[' {
+			i++
+		}
+		return p[start:i], i
+	}
+	for i := 0; i < len(p); {
+		switch p[i] {
+		case '.':
+			i++
+			recursive := false
+			if i < len(p) && p[i] == '.' {
+				recursive = true
+				i++
+			}
+			key, next := readKey(i)
+			if key == "" {
+				return nil, fmt.Errorf("invalid path %q: empty key at offset %d", path, i)
+			}
+			i = next
+			if key == "*" {
+				segments = append(segments, pathSegment{wildcard: true, recursive: recursive})
+				continue
+			}
+			segments = append(segments, pathSegment{key: key, recursive: recursive})
+		case '[':
+			end := strings.IndexByte(p[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("invalid path %q: unclosed '['", path)
+			}
+			inner := strings.TrimSpace(p[i+1 : i+end])
+			i += end + 1
+			if inner == "*" {
+				segments = append(segments, pathSegment{wildcard: true})
+				continue
+			}
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, pathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			idx, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: bad index %q", path, inner)
+			}
+			segments = append(segments, pathSegment{index: idx, isIndex: true})
+		default:
+			// Bare leading key, e.g. "data.id"
+			key, next := readKey(i)
+			i = next
+			if key == "*" {
+				segments = append(segments, pathSegment{wildcard: true})
+				continue
+			}
+			segments = append(segments, pathSegment{key: key})
+		}
+	}
+	return segments, nil
+}
+
+// decodeJSON decodes a JSON document for lookupJSONPath. Numbers are kept as json.Number,
+// so integers above 2^53, such as snowflake IDs, keep every digit.
+func decodeJSON(data string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid data after top-level value")
+	}
+	return doc, nil
+}
+
+// lookupJSONPath returns the value at path inside a decoded JSON document.
+// The boolean result reports whether the path exists. Paths containing a wildcard
+// or recursive descent always return a (possibly empty) list of every match.
+func lookupJSONPath(doc interface{}, path string) (interface{}, bool, error) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	multi := false
+	nodes := []interface{}{doc}
+	for _, seg := range segments {
+		if seg.wildcard || seg.recursive {
+			multi = true
+		}
+		var next []interface{}
+		for _, node := range nodes {
+			next = append(next, applySegment(node, seg)...)
+		}
+		nodes = next
+	}
+	if multi {
+		if nodes == nil {
+			nodes = []interface{}{}
+		}
+		return nodes, len(nodes) > 0, nil
+	}
+	if len(nodes) == 0 {
+		return nil, false, nil
+	}
+	return nodes[0], true, nil
+}
+
+func applySegment(node interface{}, seg pathSegment) []interface{} {
+	var out []interface{}
+	if seg.recursive {
+		for _, descendant := range descendants(node) {
+			out = append(out, applySegment(descendant, pathSegment{key: seg.key, wildcard: seg.wildcard})...)
+		}
+		return out
+	}
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if seg.wildcard {
+			for _, key := range sortedKeys(v) {
+				out = append(out, v[key])
+			}
+		} else if !seg.isIndex {
+			if child, ok := v[seg.key]; ok {
+				out = append(out, child)
+			}
+		}
+	case []interface{}:
+		if seg.wildcard {
+			out = append(out, v...)
+		} else if seg.isIndex {
+			idx := seg.index
+			if idx < 0 {
+				idx += len(v)
+			}
+			if idx >= 0 && idx < len(v) {
+				out = append(out, v[idx])
+			}
+		}
+	}
+	return out
+}
+
+// descendants returns node itself followed by every nested value, depth first.
+func descendants(node interface{}) []interface{} {
+	out := []interface{}{node}
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			out = append(out, descendants(v[key])...)
+		}
+	case []interface{}:
+		for _, child := range v {
+			out = append(out, descendants(child)...)
+		}
+	}
+	return out
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,679 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	jtdinfer "github.com/bombsimon/jtd-infer-go"
+	jtd "github.com/jsontypedef/json-typedef-go"
+)
+
+// jsonSchemaDialect is the $schema of inferred JSON Schema baselines.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// maxRefDepth bounds $ref resolution, so a schema referring to itself cannot loop forever.
+const maxRefDepth = 64
+
+// jsonSchemaFormat is JSON Schema draft 2020-12. The built-in validator covers the assertion
+// keywords of the applicator and validation vocabularies with local $ref, $defs and $anchor.
+// Schemas using the keywords in unsupportedKeywords are rejected rather than half-validated.
+// pattern uses Go's RE2 syntax, which rejects ECMA-262 lookarounds and backreferences.
+type jsonSchemaFormat struct{}
+
+// unsupportedKeywords are 2020-12 keywords the validator cannot evaluate, with the reason.
+var unsupportedKeywords = map[string]string{
+	"unevaluatedProperties": "unevaluatedProperties is not supported, use additionalProperties",
+	"unevaluatedItems":      "unevaluatedItems is not supported, use items",
+	"$dynamicRef":           "$dynamicRef is not supported, use $ref",
+	"$dynamicAnchor":        "$dynamicAnchor is not supported, use $anchor",
+	"$recursiveRef":         "$recursiveRef is not supported, use $ref",
+	"$recursiveAnchor":      "$recursiveAnchor is not supported, use $anchor",
+}
+
+// Keywords whose value is a subschema, an array of subschemas or a map of subschemas.
+var (
+	subschemaKeywords     = []string{"items", "contains", "additionalProperties", "propertyNames", "not", "if", "then", "else"}
+	subschemaListKeywords = []string{"prefixItems", "allOf", "anyOf", "oneOf"}
+	subschemaMapKeywords  = []string{"properties", "patternProperties", "dependentSchemas", "$defs", "definitions"}
+)
+
+func (jsonSchemaFormat) Name() string      { return FormatJSONSchema }
+func (jsonSchemaFormat) Extension() string { return ".schema.json" }
+
+// Infer infers a JTD schema, so hints work the same for both formats, and converts it.
+// Objects do not allow additional properties, matching JTD baselines.
+func (jsonSchemaFormat) Infer(bodies []string, hints SchemaHints) ([]byte, error) {
+	schema, err := inferJTD(bodies, hints)
+	if err != nil {
+		return nil, err
+	}
+	out := jtdToJSONSchema(schema)
+	out["$schema"] = jsonSchemaDialect
+	return json.MarshalIndent(out, "", "  ")
+}
+
+func jtdToJSONSchema(s jtdinfer.Schema) map[string]interface{} {
+	out := map[string]interface{}{}
+	switch {
+	case s.Enum != nil:
+		enum := make([]interface{}, len(s.Enum))
+		for i, value := range s.Enum {
+			enum[i] = value
+		}
+		out["type"] = "string"
+		out["enum"] = enum
+	case s.Type != "":
+		switch s.Type {
+		case jtd.TypeBoolean:
+			out["type"] = "boolean"
+		case jtd.TypeString:
+			out["type"] = "string"
+		case jtd.TypeTimestamp:
+			out["type"] = "string"
+			out["format"] = "date-time"
+		case jtd.TypeFloat32, jtd.TypeFloat64:
+			out["type"] = "number"
+		default:
+			out["type"] = "integer"
+		}
+	case s.Elements != nil:
+		out["type"] = "array"
+		out["items"] = jtdToJSONSchema(*s.Elements)
+	case s.Values != nil:
+		out["type"] = "object"
+		out["additionalProperties"] = jtdToJSONSchema(*s.Values)
+	case s.Discriminator != "":
+		tags := make([]string, 0, len(s.Mapping))
+		for tag := range s.Mapping {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		variants := make([]interface{}, len(tags))
+		for i, tag := range tags {
+			variant := jtdObjectToJSONSchema(s.Mapping[tag])
+			variant["properties"].(map[string]interface{})[s.Discriminator] = map[string]interface{}{"const": tag}
+			required := append(variant["required"].([]string), s.Discriminator)
+			sort.Strings(required)
+			variant["required"] = required
+			variants[i] = variant
+		}
+		out["type"] = "object"
+		out["oneOf"] = variants
+	case s.Properties != nil || s.OptionalProperties != nil:
+		out = jtdObjectToJSONSchema(s)
+	}
+
+	if s.Nullable {
+		switch {
+		case out["oneOf"] != nil:
+			out = map[string]interface{}{"anyOf": []interface{}{out, map[string]interface{}{"type": "null"}}}
+		case out["type"] != nil:
+			out["type"] = []interface{}{out["type"], "null"}
+			if enum, ok := out["enum"].([]interface{}); ok {
+				out["enum"] = append(enum, nil)
+			}
+		}
+	}
+	return out
+}
+
+func jtdObjectToJSONSchema(s jtdinfer.Schema) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for name, property := range s.Properties {
+		properties[name] = jtdToJSONSchema(property)
+		required = append(required, name)
+	}
+	for name, property := range s.OptionalProperties {
+		properties[name] = jtdToJSONSchema(property)
+	}
+	sort.Strings(required)
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func (jsonSchemaFormat) Validate(schemaData []byte, doc interface{}) ([]ValidationError, error) {
+	var root interface{}
+	if err := json.Unmarshal(schemaData, &root); err != nil {
+		return nil, fmt.Errorf("invalid schema format: %v", err)
+	}
+	if err := checkSupported(root, nil); err != nil {
+		return nil, err
+	}
+	v := &jsonSchemaValidator{root: root}
+	errs, err := v.validate(root, doc, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	sortValidationErrors(errs)
+	return errs, nil
+}
+
+// checkSupported walks every subschema and fails on keywords the validator would otherwise
+// ignore, and on embedded $id resources, whose relative references it cannot resolve.
+func checkSupported(schema interface{}, sp []string) error {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	keywords := make([]string, 0, len(s))
+	for keyword := range s {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	for _, keyword := range keywords {
+		if reason, ok := unsupportedKeywords[keyword]; ok {
+			return fmt.Errorf("unsupported schema at %s: %s", jsonPointer(appendPath(sp, keyword)), reason)
+		}
+	}
+	if _, ok := s["$id"]; ok && len(sp) > 0 {
+		return fmt.Errorf("unsupported schema at %s: $id is only supported on the root schema", jsonPointer(appendPath(sp, "$id")))
+	}
+	for _, keyword := range subschemaKeywords {
+		if sub, ok := s[keyword]; ok {
+			if err := checkSupported(sub, appendPath(sp, keyword)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, keyword := range subschemaListKeywords {
+		subs, _ := s[keyword].([]interface{})
+		for i, sub := range subs {
+			if err := checkSupported(sub, appendPath(sp, keyword, strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+	}
+	for _, keyword := range subschemaMapKeywords {
+		subs, _ := s[keyword].(map[string]interface{})
+		names := make([]string, 0, len(subs))
+		for name := range subs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := checkSupported(subs[name], appendPath(sp, keyword, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isMultipleOf reports whether value is a whole multiple of divisor, comparing the decimal
+// numbers as written rather than their float64 approximations, so 0.3 is a multiple of 0.1.
+func isMultipleOf(value, divisor float64) bool {
+	v, ok1 := new(big.Rat).SetString(strconv.FormatFloat(value, 'g', -1, 64))
+	d, ok2 := new(big.Rat).SetString(strconv.FormatFloat(divisor, 'g', -1, 64))
+	if !ok1 || !ok2 || d.Sign() == 0 {
+		return false
+	}
+	return new(big.Rat).Quo(v, d).IsInt()
+}
+
+// jsonSchemaValidator validates instances against one JSON Schema document.
+// Errors returned next to validation errors mean the schema itself is unusable.
+type jsonSchemaValidator struct {
+	root  interface{}
+	depth int
+}
+
+// appendPath returns a copy of path with tokens added, so sibling paths never share memory.
+func appendPath(path []string, tokens ...string) []string {
+	out := make([]string, 0, len(path)+len(tokens))
+	return append(append(out, path...), tokens...)
+}
+
+// matches reports whether instance is valid against schema, without collecting errors.
+func (v *jsonSchemaValidator) matches(schema, instance interface{}, ip, sp []string) (bool, error) {
+	errs, err := v.validate(schema, instance, ip, sp)
+	return len(errs) == 0, err
+}
+
+func (v *jsonSchemaValidator) validate(schema, instance interface{}, ip, sp []string) ([]ValidationError, error) {
+	var s map[string]interface{}
+	switch typed := schema.(type) {
+	case bool:
+		if typed {
+			return nil, nil
+		}
+		return []ValidationError{{jsonPointer(ip), jsonPointer(sp), "no value is allowed here"}}, nil
+	case map[string]interface{}:
+		s = typed
+	default:
+		return nil, fmt.Errorf("invalid schema at %s: expected an object or a boolean", jsonPointer(sp))
+	}
+
+	var errs []ValidationError
+	fail := func(keyword, format string, args ...interface{}) {
+		errs = append(errs, ValidationError{jsonPointer(ip), jsonPointer(appendPath(sp, keyword)), fmt.Sprintf(format, args...)})
+	}
+	apply := func(sub, inst interface{}, subIP, subSP []string) error {
+		subErrs, err := v.validate(sub, inst, subIP, subSP)
+		errs = append(errs, subErrs...)
+		return err
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := v.resolveRef(ref)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema at %s: %v", jsonPointer(sp), err)
+		}
+		if v.depth >= maxRefDepth {
+			return nil, fmt.Errorf("invalid schema at %s: $ref nested more than %d levels", jsonPointer(sp), maxRefDepth)
+		}
+		v.depth++
+		err = apply(target, instance, ip, appendPath(sp, "$ref"))
+		v.depth--
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Any instance
+	if t, ok := s["type"]; ok && !typeMatches(t, instance) {
+		fail("type", "expected type %s, got %s", typeNames(t), jsonType(instance))
+	}
+	if enum, ok := s["enum"].([]interface{}); ok && !containsJSON(enum, instance) {
+		fail("enum", "expected one of %s", compactJSON(enum))
+	}
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, instance) {
+		fail("const", "expected %s", compactJSON(c))
+	}
+
+	switch inst := instance.(type) {
+	case float64:
+		if m, ok := s["minimum"].(float64); ok && inst < m {
+			fail("minimum", "must be >= %v", m)
+		}
+		if m, ok := s["maximum"].(float64); ok && inst > m {
+			fail("maximum", "must be <= %v", m)
+		}
+		if m, ok := s["exclusiveMinimum"].(float64); ok && inst <= m {
+			fail("exclusiveMinimum", "must be > %v", m)
+		}
+		if m, ok := s["exclusiveMaximum"].(float64); ok && inst >= m {
+			fail("exclusiveMaximum", "must be < %v", m)
+		}
+		if m, ok := s["multipleOf"].(float64); ok && m > 0 && !isMultipleOf(inst, m) {
+			fail("multipleOf", "must be a multiple of %v", m)
+		}
+
+	case string:
+		length := utf8.RuneCountInString(inst)
+		if m, ok := s["minLength"].(float64); ok && float64(length) < m {
+			fail("minLength", "must be at least %v characters, got %d", m, length)
+		}
+		if m, ok := s["maxLength"].(float64); ok && float64(length) > m {
+			fail("maxLength", "must be at most %v characters, got %d", m, length)
+		}
+		if pattern, ok := s["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid schema at %s: invalid pattern %q: %v", jsonPointer(appendPath(sp, "pattern")), pattern, err)
+			}
+			if !re.MatchString(inst) {
+				fail("pattern", "must match %q", pattern)
+			}
+		}
+		if format, ok := s["format"].(string); ok && !formatMatches(format, inst) {
+			fail("format", "expected %s format", format)
+		}
+
+	case []interface{}:
+		prefix, _ := s["prefixItems"].([]interface{})
+		for i, item := range inst {
+			itemIP := appendPath(ip, strconv.Itoa(i))
+			if i < len(prefix) {
+				if err := apply(prefix[i], item, itemIP, appendPath(sp, "prefixItems", strconv.Itoa(i))); err != nil {
+					return nil, err
+				}
+			} else if items, ok := s["items"]; ok {
+				if err := apply(items, item, itemIP, appendPath(sp, "items")); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if contains, ok := s["contains"]; ok {
+			count := 0
+			for i, item := range inst {
+				ok, err := v.matches(contains, item, appendPath(ip, strconv.Itoa(i)), appendPath(sp, "contains"))
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					count++
+				}
+			}
+			minContains, hasMin := s["minContains"].(float64)
+			if !hasMin {
+				minContains = 1
+			}
+			if float64(count) < minContains {
+				fail("contains", "expected at least %v items matching contains, got %d", minContains, count)
+			}
+			if m, ok := s["maxContains"].(float64); ok && float64(count) > m {
+				fail("maxContains", "expected at most %v items matching contains, got %d", m, count)
+			}
+		}
+		if m, ok := s["minItems"].(float64); ok && float64(len(inst)) < m {
+			fail("minItems", "expected at least %v items, got %d", m, len(inst))
+		}
+		if m, ok := s["maxItems"].(float64); ok && float64(len(inst)) > m {
+			fail("maxItems", "expected at most %v items, got %d", m, len(inst))
+		}
+		if unique, _ := s["uniqueItems"].(bool); unique {
+		duplicates:
+			for i := range inst {
+				for j := i + 1; j < len(inst); j++ {
+					if reflect.DeepEqual(inst[i], inst[j]) {
+						fail("uniqueItems", "items %d and %d are equal", i, j)
+						break duplicates
+					}
+				}
+			}
+		}
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(inst))
+		for key := range inst {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		properties, _ := s["properties"].(map[string]interface{})
+		patterns := map[string]*regexp.Regexp{}
+		if patternProperties, ok := s["patternProperties"].(map[string]interface{}); ok {
+			for pattern := range patternProperties {
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("invalid schema at %s: invalid pattern %q: %v", jsonPointer(appendPath(sp, "patternProperties")), pattern, err)
+				}
+				patterns[pattern] = re
+			}
+		}
+		for _, key := range keys {
+			keyIP := appendPath(ip, key)
+			evaluated := false
+			if sub, ok := properties[key]; ok {
+				evaluated = true
+				if err := apply(sub, inst[key], keyIP, appendPath(sp, "properties", key)); err != nil {
+					return nil, err
+				}
+			}
+			for pattern, re := range patterns {
+				if re.MatchString(key) {
+					evaluated = true
+					sub := s["patternProperties"].(map[string]interface{})[pattern]
+					if err := apply(sub, inst[key], keyIP, appendPath(sp, "patternProperties", pattern)); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if additional, ok := s["additionalProperties"]; ok && !evaluated {
+				if additional == false {
+					errs = append(errs, ValidationError{jsonPointer(keyIP), jsonPointer(appendPath(sp, "additionalProperties")), "unexpected property"})
+				} else if err := apply(additional, inst[key], keyIP, appendPath(sp, "additionalProperties")); err != nil {
+					return nil, err
+				}
+			}
+			if names, ok := s["propertyNames"]; ok {
+				if err := apply(names, key, keyIP, appendPath(sp, "propertyNames")); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if required, ok := s["required"].([]interface{}); ok {
+			for _, name := range required {
+				if name, ok := name.(string); ok {
+					if _, present := inst[name]; !present {
+						fail("required", "missing required property %q", name)
+					}
+				}
+			}
+		}
+		if dependent, ok := s["dependentRequired"].(map[string]interface{}); ok {
+			for key, names := range dependent {
+				if _, present := inst[key]; !present {
+					continue
+				}
+				names, _ := names.([]interface{})
+				for _, name := range names {
+					if name, ok := name.(string); ok {
+						if _, present := inst[name]; !present {
+							fail("dependentRequired", "property %q is required when %q is present", name, key)
+						}
+					}
+				}
+			}
+		}
+		if dependent, ok := s["dependentSchemas"].(map[string]interface{}); ok {
+			for key, sub := range dependent {
+				if _, present := inst[key]; present {
+					if err := apply(sub, instance, ip, appendPath(sp, "dependentSchemas", key)); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		if m, ok := s["minProperties"].(float64); ok && float64(len(inst)) < m {
+			fail("minProperties", "expected at least %v properties, got %d", m, len(inst))
+		}
+		if m, ok := s["maxProperties"].(float64); ok && float64(len(inst)) > m {
+			fail("maxProperties", "expected at most %v properties, got %d", m, len(inst))
+		}
+	}
+
+	// Combinators
+	if allOf, ok := s["allOf"].([]interface{}); ok {
+		for i, sub := range allOf {
+			if err := apply(sub, instance, ip, appendPath(sp, "allOf", strconv.Itoa(i))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		subs, ok := s[keyword].([]interface{})
+		if !ok {
+			continue
+		}
+		count := 0
+		for i, sub := range subs {
+			ok, err := v.matches(sub, instance, ip, appendPath(sp, keyword, strconv.Itoa(i)))
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				count++
+			}
+		}
+		if keyword == "anyOf" && count == 0 {
+			fail(keyword, "does not match any of the anyOf schemas")
+		}
+		if keyword == "oneOf" && count != 1 {
+			fail(keyword, "matches %d of the oneOf schemas, expected exactly one", count)
+		}
+	}
+	if not, ok := s["not"]; ok {
+		matched, err := v.matches(not, instance, ip, appendPath(sp, "not"))
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			fail("not", "must not match the not schema")
+		}
+	}
+	if cond, ok := s["if"]; ok {
+		matched, err := v.matches(cond, instance, ip, appendPath(sp, "if"))
+		if err != nil {
+			return nil, err
+		}
+		branch := "else"
+		if matched {
+			branch = "then"
+		}
+		if sub, ok := s[branch]; ok {
+			if err := apply(sub, instance, ip, appendPath(sp, branch)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return errs, nil
+}
+
+// resolveRef finds the target of a local reference: "#", a JSON Pointer such as
+// "#/$defs/user", or a plain name fragment matching an $anchor.
+func (v *jsonSchemaValidator) resolveRef(ref string) (interface{}, error) {
+	fragment, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q: only references within the schema are resolved", ref)
+	}
+	fragment, err := url.PathUnescape(fragment)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $ref %q: %v", ref, err)
+	}
+	if fragment == "" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(fragment, "/") {
+		if target := findAnchor(v.root, fragment); target != nil {
+			return target, nil
+		}
+		return nil, fmt.Errorf("$ref %q: no $anchor %q", ref, fragment)
+	}
+	var tokens []string
+	for _, token := range strings.Split(fragment[1:], "/") {
+		tokens = append(tokens, strings.NewReplacer("~1", "/", "~0", "~").Replace(token))
+	}
+	target := lookupPointer(v.root, tokens)
+	if target == nil {
+		return nil, fmt.Errorf("$ref %q does not point to a schema", ref)
+	}
+	return target, nil
+}
+
+func findAnchor(schema interface{}, name string) interface{} {
+	switch node := schema.(type) {
+	case map[string]interface{}:
+		if node["$anchor"] == name {
+			return node
+		}
+		for _, child := range node {
+			if found := findAnchor(child, name); found != nil {
+				return found
+			}
+		}
+	case []interface{}:
+		for _, child := range node {
+			if found := findAnchor(child, name); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// jsonType returns the JSON Schema type of a decoded JSON value; whole numbers are integers.
+func jsonType(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// typeMatches checks the type keyword, a type name or a list of them.
+func typeMatches(t, instance interface{}) bool {
+	got := jsonType(instance)
+	names, ok := t.([]interface{})
+	if !ok {
+		names = []interface{}{t}
+	}
+	for _, name := range names {
+		if name == got || name == "number" && got == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func typeNames(t interface{}) string {
+	if names, ok := t.([]interface{}); ok {
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = fmt.Sprint(name)
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func containsJSON(values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if reflect.DeepEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	uuidPattern  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// formatMatches asserts the common string formats. Unknown formats are annotations and always match.
+func formatMatches(format, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "email":
+		return emailPattern.MatchString(value)
+	case "uuid":
+		return uuidPattern.MatchString(value)
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && !strings.Contains(value, ":")
+	case "ipv6":
+		return net.ParseIP(value) != nil && strings.Contains(value, ":")
+	default:
+		return true
+	}
+}
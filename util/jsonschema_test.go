@@ -0,0 +1,124 @@
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$defs": {"id": {"type": "integer", "minimum": 1}},
+		"type": "object",
+		"required": ["id", "name", "tags"],
+		"properties": {
+			"id": {"$ref": "#/$defs/id"},
+			"name": {"type": "string", "minLength": 1},
+			"email": {"type": ["string", "null"], "format": "email"},
+			"tags": {"type": "array", "items": {"enum": ["a", "b"]}, "uniqueItems": true},
+			"a/b": {"const": 1},
+			"kind": {"oneOf": [{"const": "x"}, {"type": "string", "pattern": "^y"}]}
+		},
+		"additionalProperties": false
+	}`)
+	tests := []struct {
+		doc      string
+		expected []ValidationError
+	}{
+		{`{"id": 1, "name": "n", "email": null, "tags": ["a"], "a/b": 1, "kind": "yes"}`, nil},
+		{`{"id": 0, "name": "", "email": "nope", "tags": ["a", "c", "a"], "a/b": 2, "extra": true}`, []ValidationError{
+			{"/a~1b", "/properties/a~1b/const", "expected 1"},
+			{"/email", "/properties/email/format", "expected email format"},
+			{"/extra", "/additionalProperties", "unexpected property"},
+			{"/id", "/properties/id/$ref/minimum", "must be >= 1"},
+			{"/name", "/properties/name/minLength", "must be at least 1 characters, got 0"},
+			{"/tags", "/properties/tags/uniqueItems", "items 0 and 2 are equal"},
+			{"/tags/1", "/properties/tags/items/enum", `expected one of ["a","b"]`},
+		}},
+		{`{"id": 1.5, "name": "n", "tags": [], "kind": "z"}`, []ValidationError{
+			{"/id", "/properties/id/$ref/type", "expected type integer, got number"},
+			{"/kind", "/properties/kind/oneOf", "matches 0 of the oneOf schemas, expected exactly one"},
+		}},
+	}
+	for i, tt := range tests {
+		var doc interface{}
+		json.Unmarshal([]byte(tt.doc), &doc)
+		errs, err := jsonSchemaFormat{}.Validate(schema, doc)
+		if err != nil {
+			t.Fatalf("case %d: Validate error: %v", i, err)
+		}
+		if !reflect.DeepEqual(errs, tt.expected) {
+			t.Errorf("case %d: Validate =\n%v\nexpected\n%v", i, errs, tt.expected)
+		}
+	}
+
+	if _, err := (jsonSchemaFormat{}).Validate([]byte(`{"$ref": "#/$defs/missing"}`), 1.0); err == nil {
+		t.Errorf("expected an error for an unresolvable $ref")
+	}
+}
+
+func TestJSONSchemaUnsupported(t *testing.T) {
+	tests := map[string]string{
+		`{"type": "object", "unevaluatedProperties": false}`:                      "/unevaluatedProperties",
+		`{"properties": {"a": {"items": {"$dynamicRef": "#node"}}}}`:              "/properties/a/items/$dynamicRef",
+		`{"allOf": [{"unevaluatedItems": false}]}`:                                "/allOf/0/unevaluatedItems",
+		`{"$defs": {"node": {"$id": "node.json"}}}`:                               "/$defs/node/$id",
+		`{"properties": {"unevaluatedItems": {"type": "string"}}, "$id": "root"}`: "",
+	}
+	for schema, pointer := range tests {
+		_, err := jsonSchemaFormat{}.Validate([]byte(schema), map[string]interface{}{})
+		if pointer == "" {
+			if err != nil {
+				t.Errorf("Validate(%s) error: %v", schema, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), pointer) {
+			t.Errorf("Validate(%s) error = %v, expected one at %s", schema, err, pointer)
+		}
+	}
+
+	schema := []byte(`{"multipleOf": 0.1}`)
+	for value, valid := range map[float64]bool{0.3: true, 1.7: true, 0.35: false, 3: true} {
+		errs, err := jsonSchemaFormat{}.Validate(schema, value)
+		if err != nil || (len(errs) == 0) != valid {
+			t.Errorf("multipleOf 0.1 for %v = %v, %v; expected valid %v", value, errs, err, valid)
+		}
+	}
+}
+
+func TestJSONSchemaInfer(t *testing.T) {
+	bodies := []string{
+		`{"id":1,"status":"active","created":"2024-01-02T03:04:05Z","events":[{"type":"click","x":1}]}`,
+		`{"id":2,"status":"disabled","created":"2024-01-02T03:04:05Z","note":null,"events":[{"type":"view","page":"/"}]}`,
+	}
+	hints := SchemaHints{Enums: []string{"status"}, Discriminators: []string{"events.*.type"}}
+	schema, err := jsonSchemaFormat{}.Infer(bodies, hints)
+	if err != nil {
+		t.Fatalf("Infer error: %v", err)
+	}
+
+	// Every sample is valid against the inferred schema
+	for _, body := range bodies {
+		var doc interface{}
+		json.Unmarshal([]byte(body), &doc)
+		if errs, err := (jsonSchemaFormat{}).Validate(schema, doc); err != nil || len(errs) != 0 {
+			t.Errorf("sample %s rejected: %v, %v\n%s", body, errs, err, schema)
+		}
+	}
+
+	var doc interface{}
+	json.Unmarshal([]byte(`{"id":"3","status":"gone","created":"yesterday","events":[{"type":"hover"}]}`), &doc)
+	errs, err := jsonSchemaFormat{}.Validate(schema, doc)
+	if err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+	var paths []string
+	for _, e := range errs {
+		paths = append(paths, e.InstancePath)
+	}
+	expected := []string{"/created", "/events/0", "/id", "/status"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("errors at %q, expected %q: %v", paths, expected, errs)
+	}
+}
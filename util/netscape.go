@@ -0,0 +1,93 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpOnlyPrefix marks HttpOnly cookies in Netscape cookies.txt files written by curl and browsers.
+const httpOnlyPrefix = "#HttpOnly_"
+
+// ParseNetscapeCookies reads cookies in the Netscape cookies.txt format used by curl and browser extensions:
+// domain, include-subdomains, path, secure, expiry (Unix seconds, 0 for session), name, value; tab separated.
+func ParseNetscapeCookies(r io.Reader) ([]StoredCookie, error) {
+	var cookies []StoredCookie
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if strings.HasPrefix(line, httpOnlyPrefix) {
+			httpOnly = true
+			line = strings.TrimPrefix(line, httpOnlyPrefix)
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 {
+			fields = append(fields, "") // Empty value
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d: expected 7 tab-separated fields, got %d", lineNo, len(fields))
+		}
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid expiry %q", lineNo, fields[4])
+		}
+
+		c := StoredCookie{
+			Domain:   canonicalHost(strings.TrimPrefix(fields[0], ".")),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expiry > 0 {
+			c.Expires = time.Unix(expiry, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cookies, nil
+}
+
+// WriteNetscapeCookies writes cookies in the Netscape cookies.txt format.
+func WriteNetscapeCookies(w io.Writer, cookies []StoredCookie) error {
+	if _, err := fmt.Fprintln(w, "# Netscape HTTP Cookie File"); err != nil {
+		return err
+	}
+	for _, c := range cookies {
+		domain := c.Domain
+		includeSubdomains := "FALSE"
+		if !c.HostOnly {
+			domain = "." + domain
+			includeSubdomains = "TRUE"
+		}
+		if c.HttpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		secure := "FALSE"
+		if c.Secure {
+			secure = "TRUE"
+		}
+		var expiry int64
+		if !c.Expires.IsZero() {
+			expiry = c.Expires.Unix()
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, includeSubdomains, c.Path, secure, expiry, c.Name, c.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported OAuth2 grant types.
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantPassword          = "password"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// oauthMu makes concurrent requests share a single token fetch.
+var oauthMu sync.Mutex
+
+func (o OAuth2Config) tokenVar() string {
+	if o.TokenVar == "" {
+		return "ACCESS_TOKEN"
+	}
+	return o.TokenVar
+}
+
+// Session variables holding the token expiry (unix seconds) and the latest refresh token.
+func (o OAuth2Config) expiresVar() string { return o.tokenVar() + "_EXPIRES_AT" }
+func (o OAuth2Config) refreshVar() string { return o.tokenVar() + "_REFRESH_TOKEN" }
+
+func (o OAuth2Config) refreshBefore() time.Duration {
+	if o.RefreshBefore <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(o.RefreshBefore) * time.Second
+}
+
+// tokenValid reports whether the cached token can be used until at least refresh_before from now.
+// A token without a known expiry is valid until the server rejects it.
+func (o OAuth2Config) tokenValid(session map[string]string, rejected string, now time.Time) bool {
+	token := session[o.tokenVar()]
+	if token == "" || token == rejected {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(session[o.expiresVar()], 10, 64)
+	if err != nil {
+		return true
+	}
+	return now.Add(o.refreshBefore()).Before(time.Unix(expiresAt, 0))
+}
+
+// tokenResponse is the token endpoint response of RFC 6749 section 5.1.
+type tokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	ExpiresIn        json.Number `json:"expires_in"`
+	RefreshToken     string      `json:"refresh_token"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+// EnsureOAuthToken makes sure the session holds a usable OAuth2 access token for env.
+// A new token is fetched when none is cached, when it expires within refresh_before,
+// or when it equals rejected (a token the server just refused).
+// It returns the token endpoint response if a token was fetched, nil otherwise.
+func EnsureOAuthToken(env Env, rejected string) (*Response, error) {
+	if env.Login == nil || env.Login.OAuth2 == nil {
+		return nil, nil
+	}
+	o := *env.Login.OAuth2
+
+	oauthMu.Lock()
+	defer oauthMu.Unlock()
+
+	session, err := SessionVars(env.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error loading session: %v", err)
+	}
+	if o.tokenValid(session, rejected, time.Now()) {
+		return nil, nil
+	}
+
+	t := &templater{vars: env.Resolved}
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"token_url", &o.TokenURL},
+		{"client_id", &o.ClientID},
+		{"client_secret", &o.ClientSecret},
+		{"scope", &o.Scope},
+		{"username", &o.Username},
+		{"password", &o.Password},
+		{"refresh_token", &o.RefreshToken},
+	}
+	for _, f := range fields {
+		if *f.value, err = t.renderString(*f.value, "login.oauth2."+f.name); err != nil {
+			return nil, err
+		}
+	}
+	if err := t.err(); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: time.Duration(env.Timeout) * time.Second}
+
+	// Prefer the refresh token issued by the server over repeating the configured grant
+	if refresh := session[o.refreshVar()]; refresh != "" {
+		resp, token, err := requestToken(client, o, GrantRefreshToken, refresh)
+		if err == nil {
+			if token.RefreshToken == "" {
+				token.RefreshToken = refresh // Not rotated, keep using it
+			}
+			return resp, storeToken(env.Name, o, token)
+		}
+		if o.Grant == GrantRefreshToken {
+			return resp, err
+		}
+	}
+
+	resp, token, err := requestToken(client, o, o.Grant, o.RefreshToken)
+	if err != nil {
+		return resp, err
+	}
+	return resp, storeToken(env.Name, o, token)
+}
+
+// requestToken calls the token endpoint with the given grant.
+func requestToken(client *http.Client, o OAuth2Config, grant, refreshToken string) (*Response, tokenResponse, error) {
+	var token tokenResponse
+	form := url.Values{"grant_type": {grant}}
+	switch grant {
+	case GrantClientCredentials:
+	case GrantPassword:
+		form.Set("username", o.Username)
+		form.Set("password", o.Password)
+	case GrantRefreshToken:
+		if refreshToken == "" {
+			return nil, token, fmt.Errorf("refresh_token grant requires refresh_token")
+		}
+		form.Set("refresh_token", refreshToken)
+	default:
+		return nil, token, fmt.Errorf("unsupported oauth2 grant %q (expected client_credentials, password or refresh_token)", grant)
+	}
+	if o.Scope != "" {
+		form.Set("scope", o.Scope)
+	}
+	if o.ClientAuth != "basic" && o.ClientID != "" {
+		form.Set("client_id", o.ClientID)
+		if o.ClientSecret != "" {
+			form.Set("client_secret", o.ClientSecret)
+		}
+	}
+
+	reqBody := form.Encode()
+	httpReq, err := http.NewRequest(http.MethodPost, o.TokenURL, strings.NewReader(reqBody))
+	if err != nil {
+		return nil, token, fmt.Errorf("error creating token request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+	if o.ClientAuth == "basic" {
+		httpReq.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+	}
+
+	start := time.Now()
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, token, fmt.Errorf("error executing token request: %v", err)
+	}
+	defer httpResp.Body.Close()
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, token, fmt.Errorf("error reading token response: %v", err)
+	}
+	resp := &Response{
+		ReqMethod:   http.MethodPost,
+		ReqURL:      o.TokenURL,
+		ReqHeaders:  map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+		ReqBody:     reqBody,
+		StatusCode:  httpResp.StatusCode,
+		RespHeaders: httpResp.Header,
+		RespBody:    string(respBody),
+		Duration:    time.Since(start),
+	}
+
+	if err := json.Unmarshal(respBody, &token); err != nil && httpResp.StatusCode < 300 {
+		return resp, token, fmt.Errorf("error parsing token response: %v", err)
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 || token.AccessToken == "" {
+		msg := fmt.Sprintf("status %d", httpResp.StatusCode)
+		if token.Error != "" {
+			msg += ": " + token.Error
+			if token.ErrorDescription != "" {
+				msg += " (" + token.ErrorDescription + ")"
+			}
+		} else if token.AccessToken == "" && httpResp.StatusCode < 300 {
+			msg += ": no access_token in response"
+		}
+		return resp, token, fmt.Errorf("%s token request failed with %s", grant, msg)
+	}
+	return resp, token, nil
+}
+
+// storeToken caches the token, its expiry and its refresh token in the session.
+// Empty values remove stale entries left by a previous token.
+func storeToken(envName string, o OAuth2Config, token tokenResponse) error {
+	vars := map[string]string{
+		o.tokenVar():   token.AccessToken,
+		o.expiresVar(): "",
+		o.refreshVar(): token.RefreshToken,
+	}
+	if seconds, err := token.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		vars[o.expiresVar()] = strconv.FormatInt(time.Now().Add(time.Duration(seconds)*time.Second).Unix(), 10)
+	}
+	return setSessionVars(envName, vars)
+}
@@ -0,0 +1,82 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestEnsureOAuthToken(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(LocalpostDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var grants []string
+	expiresIn := 3600
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("client_id") != "app" || r.Form.Get("client_secret") != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+		grants = append(grants, r.Form.Get("grant_type"))
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":%d,"refresh_token":"refresh-%d"}`, len(grants), expiresIn, len(grants))
+	}))
+	defer server.Close()
+
+	env := Env{
+		Name:     "dev",
+		Timeout:  5,
+		Resolved: map[string]string{"SECRET": "s3cret"},
+		Login: &LoginConfig{OAuth2: &OAuth2Config{
+			Grant:        GrantClientCredentials,
+			TokenURL:     server.URL,
+			ClientID:     "app",
+			ClientSecret: "{SECRET}",
+		}},
+	}
+	token := func() string {
+		vars, err := SessionVars("dev")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vars["ACCESS_TOKEN"]
+	}
+
+	if resp, err := EnsureOAuthToken(env, ""); err != nil || resp == nil {
+		t.Fatalf("first fetch: resp=%v err=%v", resp, err)
+	}
+	if resp, err := EnsureOAuthToken(env, ""); err != nil || resp != nil {
+		t.Fatalf("cached token should be reused: resp=%v err=%v", resp, err)
+	}
+	if token() != "token-1" {
+		t.Errorf("ACCESS_TOKEN = %q, expected token-1", token())
+	}
+
+	// A rejected token is replaced using the stored refresh token
+	expiresIn = 10 // Within the default refresh_before of 30s
+	if _, err := EnsureOAuthToken(env, "token-1"); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	// The new token expires soon, so the next call fetches proactively
+	if _, err := EnsureOAuthToken(env, ""); err != nil {
+		t.Fatalf("proactive refresh: %v", err)
+	}
+
+	expected := []string{GrantClientCredentials, GrantRefreshToken, GrantRefreshToken}
+	if fmt.Sprint(grants) != fmt.Sprint(expected) {
+		t.Errorf("grants = %v, expected %v", grants, expected)
+	}
+	if token() != "token-3" {
+		t.Errorf("ACCESS_TOKEN = %q, expected token-3", token())
+	}
+
+	env.Login.OAuth2.ClientSecret = "wrong"
+	if _, err := EnsureOAuthToken(env, "token-3"); err == nil {
+		t.Errorf("expected error for rejected client credentials")
+	}
+}
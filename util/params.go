@@ -0,0 +1,182 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// paramNamePattern is the variable name grammar of placeholderPattern.
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// PathParamName returns the parameter name of a request directory named {name} or :name.
+// ok reports whether the directory is a parameter directory; err is set when it is one
+// but its name is not a valid variable name, since it could never be substituted.
+func PathParamName(segment string) (name string, ok bool, err error) {
+	switch {
+	case strings.HasPrefix(segment, ":") && len(segment) > 1:
+		name = segment[1:]
+	case strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") && len(segment) > 2:
+		name = segment[1 : len(segment)-1]
+	default:
+		return "", false, nil
+	}
+	if !paramNamePattern.MatchString(name) {
+		return "", true, fmt.Errorf("invalid path parameter directory %q: the name must start with a letter or _ and contain only letters, digits and _", segment)
+	}
+	return name, true, nil
+}
+
+// PathParams returns the parameter names in a request path such as /users/{id}/GET, in order.
+// Directories with invalid parameter names are skipped.
+func PathParams(requestPath string) []string {
+	var names []string
+	for _, segment := range strings.Split(strings.Trim(filepath.ToSlash(requestPath), "/"), "/") {
+		if name, ok, err := PathParamName(segment); ok && err == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// urlPathTemplate turns the directory part of a request path into a URL path,
+// replacing parameter directories with {name|pathescape} placeholders.
+func urlPathTemplate(dir string) (string, error) {
+	segments := strings.Split(filepath.ToSlash(dir), "/")
+	for i, segment := range segments {
+		name, ok, err := PathParamName(segment)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			segments[i] = "{" + name + "|pathescape}"
+		}
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// ResolveRequestPath finds the request file for a path such as users/42/GET, where
+// directories named {id} or :id match any segment and bind it as a parameter.
+// Literal directories take precedence over parameter directories.
+func ResolveRequestPath(requestPath string) (string, map[string]string, error) {
+	segments := strings.Split(strings.Trim(filepath.ToSlash(requestPath), "/"), "/")
+	params := make(map[string]string)
+	filePath, ok, err := resolveSegments(RequestsDir, segments, params)
+	if err != nil {
+		return "", nil, err
+	}
+	if ok {
+		return filePath, params, nil
+	}
+	return "", nil, fmt.Errorf("request file for /%s not found", strings.Join(segments, "/"))
+}
+
+func resolveSegments(dir string, segments []string, params map[string]string) (string, bool, error) {
+	if len(segments) == 1 {
+		filePath := filepath.Join(dir, segments[0]+".yaml")
+		if info, err := os.Stat(filePath); err == nil && !info.IsDir() {
+			return filePath, true, nil
+		}
+		return "", false, nil
+	}
+
+	if info, err := os.Stat(filepath.Join(dir, segments[0])); err == nil && info.IsDir() {
+		filePath, ok, err := resolveSegments(filepath.Join(dir, segments[0]), segments[1:], params)
+		if ok || err != nil {
+			return filePath, ok, err
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false, nil
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name, ok, err := PathParamName(entry.Name())
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %v", filepath.Join(dir, entry.Name()), err)
+		}
+		if !ok {
+			continue
+		}
+		filePath, ok, err := resolveSegments(filepath.Join(dir, entry.Name()), segments[1:], params)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			params[name] = segments[0]
+			return filePath, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// RequestPaths lists every request under the requests directory as /path/to/METHOD, sorted.
+func RequestPaths() ([]string, error) {
+	var paths []string
+	err := filepath.Walk(RequestsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".yaml") {
+			relPath, err := filepath.Rel(RequestsDir, path)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, "/"+strings.TrimSuffix(filepath.ToSlash(relPath), ".yaml"))
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	return paths, err
+}
+
+// CompleteRequestPath returns the request paths matching a partially typed path. Values typed
+// in place of a parameter directory are kept, so /users/42/ completes to /users/42/GET.
+// A partial last segment only fills a parameter when it matches no literal directory.
+func CompleteRequestPath(paths []string, toComplete string) []string {
+	if out := completeRequestPath(paths, toComplete, false); len(out) > 0 {
+		return out
+	}
+	return completeRequestPath(paths, toComplete, true)
+}
+
+func completeRequestPath(paths []string, toComplete string, partialParams bool) []string {
+	typed := strings.Split(strings.TrimPrefix(toComplete, "/"), "/")
+	seen := make(map[string]bool)
+	var out []string
+	for _, path := range paths {
+		segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+		if len(typed) > len(segments) {
+			continue
+		}
+		matched := true
+		for i, t := range typed {
+			_, isParam, _ := PathParamName(segments[i])
+			last := i == len(typed)-1
+			switch {
+			case last && strings.HasPrefix(segments[i], t):
+			case !last && segments[i] == t:
+			case isParam && t != "" && (!last || partialParams):
+				segments[i] = t
+			default:
+				matched = false
+			}
+			if !matched {
+				break
+			}
+		}
+		candidate := "/" + strings.Join(segments, "/")
+		if matched && !seen[candidate] {
+			seen[candidate] = true
+			out = append(out, candidate)
+		}
+	}
+	return out
+}
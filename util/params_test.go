@@ -0,0 +1,89 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveRequestPath(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, file := range []string{"users/{id}/GET.yaml", "users/me/GET.yaml", "users/{id}/orders/:orderId/DELETE.yaml"} {
+		path := filepath.Join(RequestsDir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("headers: {}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		file     string
+		expected map[string]string
+	}{
+		{"/users/me/GET", "users/me/GET.yaml", map[string]string{}},
+		{"/users/42/GET", "users/{id}/GET.yaml", map[string]string{"id": "42"}},
+		{"users/7/orders/9/DELETE", "users/{id}/orders/:orderId/DELETE.yaml", map[string]string{"id": "7", "orderId": "9"}},
+	}
+	for _, tt := range tests {
+		file, params, err := ResolveRequestPath(tt.path)
+		if err != nil {
+			t.Errorf("ResolveRequestPath(%s) error: %v", tt.path, err)
+			continue
+		}
+		if file != filepath.Join(RequestsDir, tt.file) || !reflect.DeepEqual(params, tt.expected) {
+			t.Errorf("ResolveRequestPath(%s) = %s %v, expected %s %v", tt.path, file, params, tt.file, tt.expected)
+		}
+	}
+	if _, _, err := ResolveRequestPath("/users/42/POST"); err == nil {
+		t.Errorf("expected error for missing request")
+	}
+
+	paths, err := RequestPaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	completions := map[string][]string{
+		"/users/m":     {"/users/me/GET"},
+		"/users/42/":   {"/users/42/GET", "/users/42/orders/:orderId/DELETE"},
+		"/users/42/or": {"/users/42/orders/:orderId/DELETE"},
+		"/users/42":    {"/users/42/GET", "/users/42/orders/:orderId/DELETE"},
+		"/users/{":     {"/users/{id}/GET", "/users/{id}/orders/:orderId/DELETE"},
+	}
+	for typed, expected := range completions {
+		if got := CompleteRequestPath(paths, typed); !reflect.DeepEqual(got, expected) {
+			t.Errorf("CompleteRequestPath(%q) = %v, expected %v", typed, got, expected)
+		}
+	}
+
+	if got, err := urlPathTemplate("users/{id}/orders/:orderId"); err != nil || got != "users/{id|pathescape}/orders/{orderId|pathescape}" {
+		t.Errorf("urlPathTemplate = %q, %v", got, err)
+	}
+}
+
+func TestInvalidPathParamName(t *testing.T) {
+	for _, segment := range []string{"{user-id}", ":user.id", "{1st}", "{a b}"} {
+		if _, ok, err := PathParamName(segment); !ok || err == nil || !strings.Contains(err.Error(), segment) {
+			t.Errorf("PathParamName(%q) = %v, %v; expected an error naming the directory", segment, ok, err)
+		}
+	}
+	for _, segment := range []string{"users", "{id}", ":_orderId2"} {
+		if _, _, err := PathParamName(segment); err != nil {
+			t.Errorf("PathParamName(%q) error: %v", segment, err)
+		}
+	}
+
+	t.Chdir(t.TempDir())
+	writeTestConfig(t, &Config{Env: "dev", Envs: map[string]Env{"dev": {Vars: map[string]string{"BASE_URL": "http://api"}}}})
+	writeRequests(t, map[string]string{"users/{user-id}/GET.yaml": ""})
+	if _, _, err := ResolveRequestPath("/users/42/GET"); err == nil || !strings.Contains(err.Error(), "{user-id}") {
+		t.Errorf("ResolveRequestPath error = %v, expected the invalid directory", err)
+	}
+	if _, err := readRequestDefinition(RequestFilePath("users/{user-id}/GET")); err == nil || !strings.Contains(err.Error(), "{user-id}") {
+		t.Errorf("readRequestDefinition error = %v, expected the invalid directory", err)
+	}
+}
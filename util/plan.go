@@ -0,0 +1,276 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Folder hooks: requests under users/_setup run before every request under users/, and
+// requests under users/_teardown run after them, whatever their outcome.
+const (
+	HookSetup    = "_setup"
+	HookTeardown = "_teardown"
+)
+
+// TestPlan is the dependency graph lpost test runs: requests selected by the filter, the
+// requests they depend on, and the setup and teardown hooks of their folders.
+type TestPlan struct {
+	Steps []TestStep // Sorted by name
+}
+
+// TestStep is one request of a plan.
+type TestStep struct {
+	Path    string // Request file
+	Name    string // Request path, e.g. users/_setup/POST
+	Hook    string // HookSetup or HookTeardown for folder hooks, empty for tests
+	Retries Retries
+	Needs   []int // Steps that must pass first; the step is skipped if one does not
+	After   []int // Steps that must only finish first, so teardowns run after failures too
+}
+
+// hookOf returns the hook kind of a request file and the folder it belongs to.
+func hookOf(filePath string) (hook, folder string) {
+	parts := strings.Split(filepath.ToSlash(filepath.Dir(filePath)), "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if parts[i] == HookSetup || parts[i] == HookTeardown {
+			return parts[i], strings.Join(parts[:i], "/")
+		}
+	}
+	return "", ""
+}
+
+// scopes returns the folders whose hooks surround a request, from the requests root down.
+// The hooks of a folder are in the scope of its parent folders, not of the folder itself.
+func scopes(filePath string) []string {
+	dir := filepath.ToSlash(filepath.Dir(filePath))
+	if _, folder := hookOf(filePath); folder != "" {
+		dir = filepath.ToSlash(filepath.Dir(folder))
+	}
+	root := filepath.ToSlash(RequestsDir)
+	if dir != root && !strings.HasPrefix(dir, root+"/") {
+		return nil
+	}
+	folders := []string{root}
+	for _, part := range strings.Split(strings.TrimPrefix(dir, root), "/") {
+		if part != "" {
+			folders = append(folders, folders[len(folders)-1]+"/"+part)
+		}
+	}
+	return folders
+}
+
+// folderHooks returns the request files of a folder's setup or teardown hook, sorted.
+func folderHooks(folder, hook string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(filepath.Join(filepath.FromSlash(folder), hook), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), ".yaml") {
+			files = append(files, filepath.ToSlash(path))
+		}
+		return nil
+	})
+	return files, err
+}
+
+// PlanTests builds the plan for the selected request files. Requests named in depends-on and
+// the hooks of every folder a request is in are added, and cycles are reported as errors.
+func PlanTests(files []string) (TestPlan, error) {
+	type node struct {
+		path      string
+		dependsOn []string
+		retries   Retries
+	}
+	nodes := map[string]*node{}
+	queue := slices.Clone(files)
+	for len(queue) > 0 {
+		path := filepath.ToSlash(filepath.Clean(queue[0]))
+		queue = queue[1:]
+		if nodes[path] != nil {
+			continue
+		}
+		meta, err := readRequestMeta(path)
+		if err != nil {
+			return TestPlan{}, err
+		}
+		n := &node{path: path, retries: meta.Retries}
+		nodes[path] = n
+		for _, ref := range meta.DependsOn {
+			dep := filepath.ToSlash(RequestFilePath(ref))
+			if _, err := os.Stat(dep); err != nil {
+				return TestPlan{}, fmt.Errorf("%s depends on %s, which does not exist", path, ref)
+			}
+			n.dependsOn = append(n.dependsOn, dep)
+			queue = append(queue, dep)
+		}
+		for _, folder := range scopes(path) {
+			for _, hook := range []string{HookSetup, HookTeardown} {
+				hookFiles, err := folderHooks(folder, hook)
+				if err != nil {
+					return TestPlan{}, fmt.Errorf("error reading %s hooks of %s: %v", hook, folder, err)
+				}
+				queue = append(queue, hookFiles...)
+			}
+		}
+	}
+
+	var plan TestPlan
+	for path := range nodes {
+		rel, _ := filepath.Rel(RequestsDir, filepath.FromSlash(path))
+		hook, _ := hookOf(path)
+		plan.Steps = append(plan.Steps, TestStep{
+			Path:    filepath.FromSlash(path),
+			Name:    strings.TrimSuffix(filepath.ToSlash(rel), ".yaml"),
+			Hook:    hook,
+			Retries: nodes[path].retries,
+		})
+	}
+	sort.Slice(plan.Steps, func(i, j int) bool { return plan.Steps[i].Name < plan.Steps[j].Name })
+	index := make(map[string]int, len(plan.Steps))
+	for i, step := range plan.Steps {
+		index[filepath.ToSlash(step.Path)] = i
+	}
+
+	// Hooks of each folder, by kind
+	hooks := map[string]map[string][]int{}
+	for i, step := range plan.Steps {
+		if hook, folder := hookOf(step.Path); hook != "" {
+			if hooks[folder] == nil {
+				hooks[folder] = map[string][]int{}
+			}
+			hooks[folder][hook] = append(hooks[folder][hook], i)
+		}
+	}
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+		for _, dep := range nodes[filepath.ToSlash(step.Path)].dependsOn {
+			step.Needs = appendUnique(step.Needs, index[dep])
+		}
+		for _, folder := range scopes(step.Path) {
+			for _, setup := range hooks[folder][HookSetup] {
+				step.Needs = appendUnique(step.Needs, setup)
+			}
+			for _, teardown := range hooks[folder][HookTeardown] {
+				plan.Steps[teardown].After = appendUnique(plan.Steps[teardown].After, i)
+			}
+		}
+		if step.Hook == HookTeardown {
+			_, folder := hookOf(step.Path)
+			for _, setup := range hooks[folder][HookSetup] {
+				step.After = appendUnique(step.After, setup)
+			}
+		}
+	}
+
+	if cycle := plan.cycle(); cycle != nil {
+		return TestPlan{}, fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return plan, nil
+}
+
+func appendUnique(list []int, i int) []int {
+	if slices.Contains(list, i) {
+		return list
+	}
+	return append(list, i)
+}
+
+// cycle returns the names along a dependency cycle, or nil if the plan has none.
+func (p TestPlan) cycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(p.Steps))
+	var stack []int
+	var visit func(i int) []string
+	visit = func(i int) []string {
+		state[i] = visiting
+		stack = append(stack, i)
+		for _, j := range append(slices.Clone(p.Steps[i].Needs), p.Steps[i].After...) {
+			switch state[j] {
+			case visiting:
+				start := slices.Index(stack, j)
+				var names []string
+				for _, k := range stack[start:] {
+					names = append(names, p.Steps[k].Name)
+				}
+				return append(names, p.Steps[j].Name)
+			case unvisited:
+				if cycle := visit(j); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[i] = visited
+		return nil
+	}
+	for i := range p.Steps {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// Run runs every step as soon as the steps it waits for are done, independent steps in
+// parallel, at most concurrency at a time if it is positive. run reports whether a step
+// passed; a step whose Needs did not all pass is passed to skip instead, with the reason.
+// run waits with pause, e.g. before a retry, so other steps can use its slot meanwhile.
+func (p TestPlan) Run(concurrency int, run func(i int, pause func(time.Duration)) bool, skip func(i int, reason string)) {
+	var slots chan struct{}
+	if concurrency > 0 {
+		slots = make(chan struct{}, concurrency)
+	}
+	done := make([]chan struct{}, len(p.Steps))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	passed := make([]bool, len(p.Steps))
+	var wg sync.WaitGroup
+	for i, step := range p.Steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+			for _, j := range step.Needs {
+				<-done[j]
+			}
+			for _, j := range step.After {
+				<-done[j]
+			}
+			for _, j := range step.Needs {
+				if !passed[j] {
+					skip(i, fmt.Sprintf("%s did not pass", p.Steps[j].Name))
+					return
+				}
+			}
+			pause := time.Sleep
+			if slots != nil {
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				pause = func(d time.Duration) {
+					<-slots
+					time.Sleep(d)
+					slots <- struct{}{}
+				}
+			}
+			passed[i] = run(i, pause)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,142 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPlanTests(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeRequests(t, map[string]string{
+		"_setup/POST.yaml":          "",
+		"users/_setup/POST.yaml":    "",
+		"users/_teardown/POST.yaml": "",
+		"users/GET.yaml":            "",
+		"users/{id}/DELETE.yaml":    "depends-on:\n  - /users/{id}/PUT\n",
+		"users/{id}/PUT.yaml":       "",
+		"orders/GET.yaml":           "",
+	})
+
+	files, err := DiscoverRequests(TestFilter{Patterns: []string{"users/{id}/DELETE"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := PlanTests(files)
+	if err != nil {
+		t.Fatalf("PlanTests error: %v", err)
+	}
+	names := func(indexes []int) []string {
+		var out []string
+		for _, i := range indexes {
+			out = append(out, plan.Steps[i].Name)
+		}
+		return out
+	}
+	steps := map[string]TestStep{}
+	var all []string
+	for _, step := range plan.Steps {
+		steps[step.Name] = step
+		all = append(all, step.Name)
+	}
+	// The dependency and the hooks around it are added; unrelated requests are not
+	expected := []string{"_setup/POST", "users/_setup/POST", "users/_teardown/POST", "users/{id}/DELETE", "users/{id}/PUT"}
+	if !reflect.DeepEqual(all, expected) {
+		t.Fatalf("steps = %v, expected %v", all, expected)
+	}
+	if got := names(steps["users/{id}/DELETE"].Needs); !reflect.DeepEqual(got, []string{"users/{id}/PUT", "_setup/POST", "users/_setup/POST"}) {
+		t.Errorf("DELETE needs %v", got)
+	}
+	if got := names(steps["users/_setup/POST"].Needs); !reflect.DeepEqual(got, []string{"_setup/POST"}) {
+		t.Errorf("users setup needs %v", got)
+	}
+	teardown := steps["users/_teardown/POST"]
+	if got := names(teardown.After); !reflect.DeepEqual(got, []string{"users/_setup/POST", "users/{id}/DELETE", "users/{id}/PUT"}) {
+		t.Errorf("teardown runs after %v", got)
+	}
+	if got := names(teardown.Needs); !reflect.DeepEqual(got, []string{"_setup/POST"}) {
+		t.Errorf("teardown needs %v", got)
+	}
+
+	writeRequests(t, map[string]string{"users/{id}/PUT.yaml": "depends-on: ['users/{id}/DELETE']\n"})
+	if _, err := PlanTests(files); err == nil || !strings.Contains(err.Error(), "dependency cycle: users/{id}/DELETE -> users/{id}/PUT -> users/{id}/DELETE") {
+		t.Errorf("expected a cycle error, got %v", err)
+	}
+	writeRequests(t, map[string]string{"users/{id}/PUT.yaml": "depends-on: [users/POST]\n"})
+	if _, err := PlanTests(files); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected a missing dependency error, got %v", err)
+	}
+}
+
+func TestTestPlanRun(t *testing.T) {
+	// 0 setup, 1 create (fails), 2 delete needs create, 3 list, 4 teardown after all
+	plan := TestPlan{Steps: []TestStep{
+		{Name: "setup"},
+		{Name: "create", Needs: []int{0}},
+		{Name: "delete", Needs: []int{0, 1}},
+		{Name: "list", Needs: []int{0}},
+		{Name: "teardown", After: []int{0, 1, 2, 3}},
+	}}
+	var mu sync.Mutex
+	var order []string
+	skipped := map[string]string{}
+	plan.Run(0, func(i int, pause func(time.Duration)) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, plan.Steps[i].Name)
+		return plan.Steps[i].Name != "create"
+	}, func(i int, reason string) {
+		mu.Lock()
+		defer mu.Unlock()
+		skipped[plan.Steps[i].Name] = reason
+	})
+
+	if order[0] != "setup" || order[len(order)-1] != "teardown" || len(order) != 4 {
+		t.Errorf("run order = %v", order)
+	}
+	if !reflect.DeepEqual(skipped, map[string]string{"delete": "create did not pass"}) {
+		t.Errorf("skipped = %v", skipped)
+	}
+}
+
+func TestTestPlanRunConcurrency(t *testing.T) {
+	plan := TestPlan{Steps: make([]TestStep, 8)}
+	var running, peak atomic.Int32
+	plan.Run(2, func(i int, pause func(time.Duration)) bool {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return true
+	}, func(i int, reason string) {})
+	if peak.Load() != 2 {
+		t.Errorf("peak concurrency = %d, expected 2", peak.Load())
+	}
+}
+
+func TestTestPlanRunPause(t *testing.T) {
+	// Each step waits until both have started, which only works if a pause frees the only slot
+	plan := TestPlan{Steps: make([]TestStep, 2)}
+	var started, passed atomic.Int32
+	plan.Run(1, func(i int, pause func(time.Duration)) bool {
+		started.Add(1)
+		for deadline := time.Now().Add(time.Second); started.Load() < 2; pause(time.Millisecond) {
+			if time.Now().After(deadline) {
+				return false
+			}
+		}
+		passed.Add(1)
+		return true
+	}, func(i int, reason string) {})
+	if passed.Load() != 2 {
+		t.Errorf("%d of 2 steps ran while the other paused", passed.Load())
+	}
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UnmarshalYAML reads a query: mapping in file order. A list value repeats the key.
+func (q *QueryParams) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: query must be a mapping", value.Line)
+	}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key, val := value.Content[i].Value, value.Content[i+1]
+		switch val.Kind {
+		case yaml.ScalarNode:
+			*q = append(*q, QueryParam{Key: key, Value: scalarValue(val)})
+		case yaml.SequenceNode:
+			for _, item := range val.Content {
+				if item.Kind != yaml.ScalarNode {
+					return fmt.Errorf("line %d: query %s values must be scalars", item.Line, key)
+				}
+				*q = append(*q, QueryParam{Key: key, Value: scalarValue(item)})
+			}
+		default:
+			return fmt.Errorf("line %d: query %s must be a scalar or a list", val.Line, key)
+		}
+	}
+	return nil
+}
+
+// MarshalYAML writes the parameters back as a mapping, grouping repeated keys into lists.
+func (q QueryParams) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	index := make(map[string]*yaml.Node)
+	for _, p := range q {
+		value := &yaml.Node{Kind: yaml.ScalarNode, Value: p.Value}
+		if existing, ok := index[p.Key]; ok {
+			if existing.Kind == yaml.ScalarNode {
+				first := *existing
+				*existing = yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{&first}}
+			}
+			existing.Content = append(existing.Content, value)
+			continue
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: p.Key}, value)
+		index[p.Key] = value
+	}
+	return node, nil
+}
+
+// scalarValue returns a scalar's text, with null as an empty string.
+func scalarValue(node *yaml.Node) string {
+	if node.Tag == "!!null" {
+		return ""
+	}
+	return node.Value
+}
+
+// appendQuery adds encoded parameters to rawURL after any query it already has,
+// leaving the existing query and the parameter order untouched.
+func appendQuery(rawURL string, params QueryParams) string {
+	if len(params) == 0 {
+		return rawURL
+	}
+	base, fragment, hasFragment := strings.Cut(rawURL, "#")
+	pairs := make([]string, 0, len(params))
+	for _, p := range params {
+		pairs = append(pairs, url.QueryEscape(p.Key)+"="+url.QueryEscape(p.Value))
+	}
+	switch {
+	case !strings.Contains(base, "?"):
+		base += "?"
+	case !strings.HasSuffix(base, "?") && !strings.HasSuffix(base, "&"):
+		base += "&"
+	}
+	base += strings.Join(pairs, "&")
+	if hasFragment {
+		base += "#" + fragment
+	}
+	return base
+}
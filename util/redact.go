@@ -0,0 +1,265 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces secrets in reports.
+const RedactedValue = "[REDACTED]"
+
+// sensitiveNames are parts of header, property, query parameter and variable names whose values
+// are secrets. Names are compared lowercased, without - and _, so X-Api-Key matches apikey.
+var sensitiveNames = []string{"authorization", "cookie", "password", "passwd", "secret", "token", "apikey", "privatekey", "credential", "signature"}
+
+// Redactor hides secrets in requests and responses before they are written to a report.
+type Redactor struct {
+	names  []string
+	values []string // Values of sensitive variables, replaced wherever they appear
+}
+
+// NewRedactor returns a redactor for the built-in sensitive names plus extra ones. Values of
+// sensitive variables in vars, such as PASSWORD or API_TOKEN, are redacted anywhere they appear.
+// Pass the variables from before and after a run, so tokens replaced during it are covered too.
+func NewRedactor(extra []string, vars ...map[string]string) *Redactor {
+	r := &Redactor{names: append([]string{}, sensitiveNames...)}
+	for _, name := range extra {
+		r.names = append(r.names, normalizeName(name))
+	}
+	for _, layer := range vars {
+		for name, value := range layer {
+			if len(value) >= 4 && r.sensitive(name) && !slices.Contains(r.values, value) {
+				r.values = append(r.values, value)
+			}
+		}
+	}
+	// Longest first, so a secret containing another one is replaced whole
+	sort.Slice(r.values, func(i, j int) bool { return len(r.values[i]) > len(r.values[j]) })
+	return r
+}
+
+func normalizeName(name string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+}
+
+// sensitive reports whether values named name are secrets.
+func (r *Redactor) sensitive(name string) bool {
+	name = normalizeName(name)
+	for _, part := range r.names {
+		if part != "" && strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// Response returns a copy of resp with secrets redacted from the URL, headers and bodies,
+// including those of an automatic login.
+func (r *Redactor) Response(resp Response) Response {
+	out := resp
+	out.ReqURL = r.URL(resp.ReqURL)
+	out.ReqHeaders = make(map[string]string, len(resp.ReqHeaders))
+	for key, value := range resp.ReqHeaders {
+		if r.sensitive(key) {
+			value = RedactedValue
+		}
+		out.ReqHeaders[key] = r.text(value)
+	}
+	out.RespHeaders = make(map[string][]string, len(resp.RespHeaders))
+	for key, values := range resp.RespHeaders {
+		redacted := make([]string, len(values))
+		for i, value := range values {
+			if r.sensitive(key) {
+				value = RedactedValue
+			}
+			redacted[i] = r.text(value)
+		}
+		out.RespHeaders[key] = redacted
+	}
+	out.ReqBody = r.Body(resp.ReqBody)
+	out.RespBody = r.Body(resp.RespBody)
+	out.Assertions = r.assertions(resp.Assertions)
+	if resp.AuthRefresh != nil {
+		refresh := *resp.AuthRefresh
+		refresh.LoginResponse = r.Response(refresh.LoginResponse)
+		out.AuthRefresh = &refresh
+	}
+	return out
+}
+
+// Report returns a copy of report with secrets redacted from every response.
+func (r *Redactor) Report(report TestReport) TestReport {
+	out := report
+	out.Results = make([]TestResult, len(report.Results))
+	for i, result := range report.Results {
+		if result.Response != nil {
+			redacted := r.Response(*result.Response)
+			result.Response = &redacted
+		}
+		// Failure reasons can quote the values that were sent or received
+		result.Message = r.text(result.Message)
+		if result.Retried != nil {
+			retried := make([]string, len(result.Retried))
+			for j, reason := range result.Retried {
+				retried[j] = r.text(reason)
+			}
+			result.Retried = retried
+		}
+		result.Assertions = r.assertions(result.Assertions)
+		if result.SchemaErrors != nil {
+			schemaErrors := make([]ValidationError, len(result.SchemaErrors))
+			for j, schemaError := range result.SchemaErrors {
+				schemaError.Message = r.text(schemaError.Message)
+				schemaErrors[j] = schemaError
+			}
+			result.SchemaErrors = schemaErrors
+		}
+		out.Results[i] = result
+	}
+	return out
+}
+
+// assertions redacts the expected and received values in assertion results. Both are hidden
+// whole for sensitive headers and properties, e.g. `header Authorization equals [REDACTED]`.
+func (r *Redactor) assertions(assertions []AssertionResult) []AssertionResult {
+	if assertions == nil {
+		return nil
+	}
+	out := make([]AssertionResult, len(assertions))
+	for i, a := range assertions {
+		a.Name, a.Message = r.text(a.Name), r.text(a.Message)
+		// Names are "<header|body> <name or path> <check> <expected value>", see checkHeader and checkBody
+		fields := strings.SplitN(a.Name, " ", 4)
+		if len(fields) == 4 && (fields[0] == "header" || fields[0] == "body") && r.sensitive(fields[1]) {
+			a.Name = strings.Join(fields[:3], " ") + " " + RedactedValue
+			if strings.HasPrefix(a.Message, "got ") {
+				a.Message = "got " + RedactedValue
+			}
+		}
+		out[i] = a
+	}
+	return out
+}
+
+// URL redacts sensitive query parameters.
+func (r *Redactor) URL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return r.text(rawURL)
+	}
+	query := u.Query()
+	changed := false
+	for key := range query {
+		if r.sensitive(key) {
+			query[key] = []string{RedactedValue}
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = query.Encode()
+	}
+	return r.text(u.String())
+}
+
+// Body redacts sensitive properties of a JSON body or fields of a form-urlencoded body.
+// Other bodies only have the values of sensitive variables redacted.
+func (r *Redactor) Body(body string) string {
+	trimmed := strings.TrimSpace(body)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		decoder := json.NewDecoder(strings.NewReader(trimmed))
+		decoder.UseNumber()
+		var doc interface{}
+		if err := decoder.Decode(&doc); err == nil {
+			var buf bytes.Buffer
+			encoder := json.NewEncoder(&buf)
+			encoder.SetEscapeHTML(false)
+			if err := encoder.Encode(r.redactJSON(doc)); err == nil {
+				return r.text(strings.TrimSuffix(buf.String(), "\n"))
+			}
+		}
+	}
+	if strings.Contains(body, "=") && !strings.ContainsAny(body, " \n{<") {
+		if form, err := url.ParseQuery(body); err == nil {
+			changed := false
+			for key := range form {
+				if r.sensitive(key) {
+					form[key] = []string{RedactedValue}
+					changed = true
+				}
+			}
+			if changed {
+				return r.text(form.Encode())
+			}
+		}
+	}
+	return r.text(body)
+}
+
+// Sample returns a JSON body compacted and with secrets redacted, for recording as a sample.
+// Unlike Body it only replaces strings, so baselines inferred from samples keep every type.
+func (r *Redactor) Sample(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(r.redactStrings(doc, false)); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// redactStrings replaces the strings in and below sensitive properties, and the values of
+// sensitive variables in all other strings.
+func (r *Redactor) redactStrings(v interface{}, sensitive bool) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			val[key] = r.redactStrings(child, sensitive || r.sensitive(key))
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = r.redactStrings(child, sensitive)
+		}
+	case string:
+		if sensitive {
+			return RedactedValue
+		}
+		return r.text(val)
+	}
+	return v
+}
+
+func (r *Redactor) redactJSON(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			if r.sensitive(key) && child != nil {
+				val[key] = RedactedValue
+			} else {
+				val[key] = r.redactJSON(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = r.redactJSON(child)
+		}
+	}
+	return v
+}
+
+// text replaces the values of sensitive variables.
+func (r *Redactor) text(s string) string {
+	for _, value := range r.values {
+		s = strings.ReplaceAll(s, value, RedactedValue)
+	}
+	return s
+}
@@ -0,0 +1,104 @@
+package util
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRedactor(t *testing.T) {
+	r := NewRedactor([]string{"X-Session"}, map[string]string{"DB_PASSWORD": "hunter22", "BASE_URL": "http://api", "PIN_TOKEN": "12"})
+	resp := r.Response(Response{
+		ReqURL:      "http://api/login?api_key=abc&page=2",
+		ReqHeaders:  map[string]string{"Authorization": "Bearer xyz", "Accept": "application/json", "X-Session": "s1"},
+		ReqBody:     `{"user":"bob","password":"hunter22","nested":[{"refresh_token":"r1","id":1}]}`,
+		RespHeaders: map[string][]string{"Set-Cookie": {"sid=1"}, "X-Note": {"pass hunter22 here"}},
+		RespBody:    "client_id=app&client_secret=shh",
+	})
+
+	if resp.ReqURL != "http://api/login?api_key=%5BREDACTED%5D&page=2" {
+		t.Errorf("URL = %q", resp.ReqURL)
+	}
+	if resp.ReqHeaders["Authorization"] != RedactedValue || resp.ReqHeaders["X-Session"] != RedactedValue || resp.ReqHeaders["Accept"] != "application/json" {
+		t.Errorf("request headers = %v", resp.ReqHeaders)
+	}
+	if expected := `{"nested":[{"id":1,"refresh_token":"[REDACTED]"}],"password":"[REDACTED]","user":"bob"}`; resp.ReqBody != expected {
+		t.Errorf("JSON body = %s", resp.ReqBody)
+	}
+	if resp.RespHeaders["Set-Cookie"][0] != RedactedValue || resp.RespHeaders["X-Note"][0] != "pass [REDACTED] here" {
+		t.Errorf("response headers = %v", resp.RespHeaders)
+	}
+	if resp.RespBody != "client_id=app&client_secret=%5BREDACTED%5D" {
+		t.Errorf("form body = %s", resp.RespBody)
+	}
+	// Short values of sensitive variables are not replaced everywhere
+	if strings.Contains(r.Body("page 12"), RedactedValue) {
+		t.Error("short secret values should not be redacted in text")
+	}
+}
+
+func TestRedactReport(t *testing.T) {
+	// The token was replaced by a login during the run, so both values are secrets
+	r := NewRedactor(nil, map[string]string{"API_TOKEN": "old-token"}, map[string]string{"API_TOKEN": "new-token"})
+	report := TestReport{Results: []TestResult{
+		{Name: "users/GET", Response: &Response{ReqURL: "http://api/users?t=old-token", RespBody: "issued new-token"}},
+		{Name: "orders/GET", Outcome: OutcomeError},
+		{Name: "me/GET", Outcome: OutcomeFailed, Message: "assertion failed: got new-token",
+			Retried:    []string{"status 401 with old-token"},
+			Assertions: []AssertionResult{{Name: "body.token", Message: "got new-token"}}},
+	}}
+	redacted := r.Report(report)
+	if resp := redacted.Results[0].Response; resp.ReqURL != "http://api/users?t=[REDACTED]" || resp.RespBody != "issued [REDACTED]" {
+		t.Errorf("redacted response = %+v", resp)
+	}
+	if redacted.Results[1].Response != nil {
+		t.Error("results without a response should stay without one")
+	}
+	if got := redacted.Results[2]; got.Message != "assertion failed: got [REDACTED]" ||
+		got.Retried[0] != "status 401 with [REDACTED]" || got.Assertions[0].Message != "got [REDACTED]" {
+		t.Errorf("redacted messages = %q, %q, %q", got.Message, got.Retried, got.Assertions[0].Message)
+	}
+	if report.Results[2].Retried[0] != "status 401 with old-token" || report.Results[2].Assertions[0].Message != "got new-token" {
+		t.Error("Report should not modify the retries and assertions of the original report")
+	}
+	if report.Results[0].Response.RespBody != "issued new-token" {
+		t.Error("Report should not modify the original report")
+	}
+}
+
+func TestRedactHTMLReport(t *testing.T) {
+	var expect Expect
+	doc := "headers:\n  X-Session-Token: s3cr3t-header\nbody:\n  $.note: key s3cr3t-var\n"
+	if err := yaml.Unmarshal([]byte(doc), &expect); err != nil {
+		t.Fatal(err)
+	}
+	resp := Response{
+		ReqMethod:   "GET",
+		ReqURL:      "http://api/me",
+		StatusCode:  200,
+		RespHeaders: map[string][]string{"X-Session-Token": {"received-session"}},
+		RespBody:    `{"note":"key other"}`,
+	}
+	resp.Assertions = evaluateExpectations(&expect, resp)
+	report := TestReport{Env: "dev", Results: []TestResult{{
+		Name: "me/GET", Outcome: OutcomeFailed, Message: "assertions failed", StatusCode: 200,
+		Response: &resp, Assertions: resp.FailedAssertions(),
+	}}}
+
+	r := NewRedactor(nil, map[string]string{"API_KEY": "s3cr3t-var"})
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, "html", r.Report(report)); err != nil {
+		t.Fatalf("WriteReport error: %v", err)
+	}
+	out := buf.String()
+	for _, secret := range []string{"s3cr3t-header", "s3cr3t-var", "received-session"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("HTML report contains %q", secret)
+		}
+	}
+	if !strings.Contains(out, "header X-Session-Token equals [REDACTED]") {
+		t.Error("HTML report should still name the failed assertion")
+	}
+}
@@ -0,0 +1,371 @@
+package util
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Test outcomes.
+const (
+	OutcomePassed  = "passed"
+	OutcomeFailed  = "failed"  // The response did not match its assertions or baseline
+	OutcomeError   = "error"   // The request could not be sent or validated
+	OutcomeSkipped = "skipped" // A request or setup it depends on did not pass
+)
+
+// TestResult is the outcome of one request run by lpost test.
+type TestResult struct {
+	Name         string // Request path, e.g. users/{id}/GET
+	Outcome      string
+	Message      string // Why the request did not pass
+	StatusCode   int
+	Duration     time.Duration
+	SchemaErrors []ValidationError
+	Assertions   []AssertionResult // Failed assertions only
+	Response     *Response         // The exchange, nil if no response was received; see Redactor.Report
+	Retried      []string          // Why each earlier attempt did not pass
+}
+
+// Flaky reports whether the request passed only after being retried.
+func (r TestResult) Flaky() bool {
+	return r.Outcome == OutcomePassed && len(r.Retried) > 0
+}
+
+// attempts returns how often the request was sent.
+func (r TestResult) attempts() int {
+	return len(r.Retried) + 1
+}
+
+// TestReport is the outcome of a whole lpost test run.
+type TestReport struct {
+	Env       string
+	StartedAt time.Time
+	Duration  time.Duration
+	Results   []TestResult
+}
+
+// flaky returns how many requests passed only after being retried.
+func (r TestReport) flaky() int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Flaky() {
+			n++
+		}
+	}
+	return n
+}
+
+// count returns how many results have the given outcome.
+func (r TestReport) count(outcome string) int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+// details lists the schema errors and failed assertions of a result, one per line.
+func (r TestResult) details() []string {
+	var lines []string
+	for _, e := range r.SchemaErrors {
+		lines = append(lines, e.String())
+	}
+	for _, a := range r.Assertions {
+		lines = append(lines, a.Name+": "+a.Message)
+	}
+	return lines
+}
+
+// reporters write a test report in a machine readable format.
+var reporters = map[string]func(w io.Writer, report TestReport) error{
+	"junit": writeJUnit,
+	"json":  writeJSONReport,
+	"tap":   writeTAP,
+	"html":  writeHTMLReport,
+}
+
+// Reporters returns the names of the supported report formats.
+func Reporters() []string {
+	names := make([]string, 0, len(reporters))
+	for name := range reporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WriteReport writes report to w in the named format: junit, json, tap or html.
+func WriteReport(w io.Writer, format string, report TestReport) error {
+	write, ok := reporters[format]
+	if !ok {
+		return fmt.Errorf("unsupported reporter %q (expected %s)", format, strings.Join(Reporters(), ", "))
+	}
+	return write(w, report)
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+type junitTestsuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestsuite `xml:"testsuite"`
+}
+
+type junitTestsuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestcase `xml:"testcase"`
+}
+
+type junitTestcase struct {
+	Name       string          `xml:"name,attr"`
+	Classname  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitProblem   `xml:"failure,omitempty"`
+	Error      *junitProblem   `xml:"error,omitempty"`
+	Skipped    *junitSkipped   `xml:"skipped,omitempty"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes the JUnit XML read by most CI test tabs. Each request is a test case,
+// grouped in classes by its directory.
+func writeJUnit(w io.Writer, report TestReport) error {
+	name := "lpost test"
+	if report.Env != "" {
+		name += " (" + report.Env + ")"
+	}
+	suite := junitTestsuite{
+		Name:      name,
+		Tests:     len(report.Results),
+		Failures:  report.count(OutcomeFailed),
+		Errors:    report.count(OutcomeError),
+		Skipped:   report.count(OutcomeSkipped),
+		Time:      seconds(report.Duration),
+		Timestamp: report.StartedAt.UTC().Format("2006-01-02T15:04:05"),
+	}
+	for _, result := range report.Results {
+		classname := strings.ReplaceAll(path.Dir(result.Name), "/", ".")
+		if classname == "." {
+			classname = "requests"
+		}
+		tc := junitTestcase{Name: result.Name, Classname: classname, Time: seconds(result.Duration)}
+		if result.StatusCode != 0 {
+			tc.SystemOut = fmt.Sprintf("HTTP %d", result.StatusCode)
+		}
+		if len(result.Retried) > 0 {
+			tc.Properties = append(tc.Properties, junitProperty{"attempts", fmt.Sprint(result.attempts())})
+			lines := []string{tc.SystemOut}
+			for i, message := range result.Retried {
+				lines = append(lines, fmt.Sprintf("Attempt %d: %s", i+1, message))
+			}
+			tc.SystemOut = strings.TrimPrefix(strings.Join(lines, "\n"), "\n")
+		}
+		if result.Flaky() {
+			tc.Properties = append(tc.Properties, junitProperty{"flaky", "true"})
+		}
+		problem := &junitProblem{Message: result.Message, Text: strings.Join(result.details(), "\n")}
+		switch {
+		case result.Outcome == OutcomeSkipped:
+			tc.Skipped = &junitSkipped{Message: result.Message}
+		case result.Outcome == OutcomeError:
+			problem.Type = "error"
+			tc.Error = problem
+		case result.Outcome == OutcomeFailed && len(result.SchemaErrors) > 0:
+			problem.Type = "schema"
+			tc.Failure = problem
+		case result.Outcome == OutcomeFailed && len(result.Assertions) > 0:
+			problem.Type = "assertion"
+			tc.Failure = problem
+		case result.Outcome == OutcomeFailed:
+			problem.Type = "failure"
+			tc.Failure = problem
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	doc := junitTestsuites{
+		Name:     name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestsuite{suite},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type jsonReport struct {
+	Env        string       `json:"env,omitempty"`
+	StartedAt  time.Time    `json:"started_at"`
+	DurationMs int64        `json:"duration_ms"`
+	Summary    jsonSummary  `json:"summary"`
+	Results    []jsonResult `json:"results"`
+}
+
+type jsonSummary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Errors  int `json:"errors"`
+	Skipped int `json:"skipped"`
+	Flaky   int `json:"flaky"`
+}
+
+type jsonResult struct {
+	Name         string            `json:"name"`
+	Outcome      string            `json:"outcome"`
+	StatusCode   int               `json:"status_code,omitempty"`
+	DurationMs   int64             `json:"duration_ms"`
+	Message      string            `json:"message,omitempty"`
+	Attempts     int               `json:"attempts"`
+	Flaky        bool              `json:"flaky,omitempty"`
+	Retried      []string          `json:"retried,omitempty"`
+	SchemaErrors []ValidationError `json:"schema_errors,omitempty"`
+	Assertions   []jsonAssertion   `json:"assertions,omitempty"`
+}
+
+type jsonAssertion struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+func writeJSONReport(w io.Writer, report TestReport) error {
+	out := jsonReport{
+		Env:        report.Env,
+		StartedAt:  report.StartedAt.UTC(),
+		DurationMs: report.Duration.Milliseconds(),
+		Summary: jsonSummary{
+			Total:   len(report.Results),
+			Passed:  report.count(OutcomePassed),
+			Failed:  report.count(OutcomeFailed),
+			Errors:  report.count(OutcomeError),
+			Skipped: report.count(OutcomeSkipped),
+			Flaky:   report.flaky(),
+		},
+		Results: []jsonResult{},
+	}
+	for _, result := range report.Results {
+		r := jsonResult{
+			Name:         result.Name,
+			Outcome:      result.Outcome,
+			StatusCode:   result.StatusCode,
+			DurationMs:   result.Duration.Milliseconds(),
+			Message:      result.Message,
+			Attempts:     result.attempts(),
+			Flaky:        result.Flaky(),
+			Retried:      result.Retried,
+			SchemaErrors: result.SchemaErrors,
+		}
+		for _, a := range result.Assertions {
+			r.Assertions = append(r.Assertions, jsonAssertion{Name: a.Name, Message: a.Message})
+		}
+		out.Results = append(out.Results, r)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// writeTAP writes TAP version 13, with a YAML diagnostic block for every request that failed.
+func writeTAP(w io.Writer, report TestReport) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "TAP version 13\n1..%d\n", len(report.Results))
+	for i, result := range report.Results {
+		if result.Flaky() {
+			fmt.Fprintf(&b, "ok %d - %s # flaky, passed on attempt %d\n", i+1, result.Name, result.attempts())
+			continue
+		}
+		if result.Outcome == OutcomePassed {
+			fmt.Fprintf(&b, "ok %d - %s\n", i+1, result.Name)
+			continue
+		}
+		if result.Outcome == OutcomeSkipped {
+			fmt.Fprintf(&b, "ok %d - %s # SKIP %s\n", i+1, result.Name, result.Message)
+			continue
+		}
+		fmt.Fprintf(&b, "not ok %d - %s\n", i+1, result.Name)
+
+		diagnostic := struct {
+			Outcome      string   `yaml:"outcome"`
+			Message      string   `yaml:"message,omitempty"`
+			StatusCode   int      `yaml:"status_code,omitempty"`
+			DurationMs   int64    `yaml:"duration_ms"`
+			Attempts     int      `yaml:"attempts,omitempty"`
+			SchemaErrors []string `yaml:"schema_errors,omitempty"`
+			Assertions   []string `yaml:"assertions,omitempty"`
+		}{
+			Outcome:    result.Outcome,
+			Message:    result.Message,
+			StatusCode: result.StatusCode,
+			DurationMs: result.Duration.Milliseconds(),
+		}
+		if len(result.Retried) > 0 {
+			diagnostic.Attempts = result.attempts()
+		}
+		for _, e := range result.SchemaErrors {
+			diagnostic.SchemaErrors = append(diagnostic.SchemaErrors, e.String())
+		}
+		for _, a := range result.Assertions {
+			diagnostic.Assertions = append(diagnostic.Assertions, a.Name+": "+a.Message)
+		}
+		data, err := yaml.Marshal(diagnostic)
+		if err != nil {
+			return err
+		}
+		b.WriteString("  ---\n")
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+		b.WriteString("  ...\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,156 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReport() TestReport {
+	return TestReport{
+		Env:       "dev",
+		StartedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Duration:  1500 * time.Millisecond,
+		Results: []TestResult{
+			{Name: "users/GET", Outcome: OutcomePassed, StatusCode: 200, Duration: 120 * time.Millisecond},
+			{Name: "users/POST", Outcome: OutcomeFailed, Message: "response does not match users/POST.jtd.json", StatusCode: 201,
+				SchemaErrors: []ValidationError{{"/id", "/properties/id/type", `expected type "string"`}}},
+			{Name: "health", Outcome: OutcomeFailed, Message: "assertions failed", StatusCode: 503,
+				Assertions: []AssertionResult{{Name: "status in [200]", Message: "got 503"}}},
+			{Name: "orders/GET", Outcome: OutcomeError, Message: "connection refused"},
+		},
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, "junit", testReport()); err != nil {
+		t.Fatalf("WriteReport error: %v", err)
+	}
+	var doc junitTestsuites
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+	if doc.Tests != 4 || doc.Failures != 2 || doc.Errors != 1 || len(doc.Suites) != 1 {
+		t.Fatalf("counts = %d tests, %d failures, %d errors", doc.Tests, doc.Failures, doc.Errors)
+	}
+	cases := doc.Suites[0].Cases
+	if cases[0].Classname != "users" || cases[0].Failure != nil || cases[0].SystemOut != "HTTP 200" {
+		t.Errorf("passed case = %+v", cases[0])
+	}
+	if f := cases[1].Failure; f == nil || f.Type != "schema" || !strings.Contains(f.Text, "/id: expected type") {
+		t.Errorf("schema failure = %+v", f)
+	}
+	if f := cases[2].Failure; f == nil || f.Type != "assertion" || f.Text != "status in [200]: got 503" || cases[2].Classname != "requests" {
+		t.Errorf("assertion failure = %+v", cases[2])
+	}
+	if e := cases[3].Error; e == nil || e.Message != "connection refused" {
+		t.Errorf("error case = %+v", cases[3])
+	}
+}
+
+func TestWriteJSONReport(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, "json", testReport()); err != nil {
+		t.Fatalf("WriteReport error: %v", err)
+	}
+	var out jsonReport
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if out.Summary != (jsonSummary{Total: 4, Passed: 1, Failed: 2, Errors: 1}) || out.DurationMs != 1500 {
+		t.Errorf("summary = %+v, duration %d", out.Summary, out.DurationMs)
+	}
+	if r := out.Results[1]; r.StatusCode != 201 || len(r.SchemaErrors) != 1 || r.SchemaErrors[0].InstancePath != "/id" {
+		t.Errorf("schema result = %+v", r)
+	}
+}
+
+func TestWriteTAP(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, "tap", testReport()); err != nil {
+		t.Fatalf("WriteReport error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"TAP version 13\n1..4\n",
+		"ok 1 - users/GET\n",
+		"not ok 2 - users/POST\n  ---\n  outcome: failed\n",
+		"    - 'status in [200]: got 503'\n",
+		"not ok 4 - orders/GET\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("TAP output missing %q:\n%s", want, out)
+		}
+	}
+
+	if err := WriteReport(&buf, "pdf", testReport()); err == nil {
+		t.Error("expected an error for an unknown reporter")
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	report := testReport()
+	report.Results[0].Response = &Response{
+		ReqMethod:   "GET",
+		ReqURL:      "http://api/users",
+		ReqHeaders:  map[string]string{"Accept": "application/json"},
+		RespHeaders: map[string][]string{"Content-Type": {"application/json"}},
+		RespBody:    `{"name":"<script>"}`,
+		Assertions:  []AssertionResult{{Name: "status in [200]", Passed: true}},
+	}
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, "html", report); err != nil {
+		t.Fatalf("WriteReport error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<title>lpost test report (dev)</title>",
+		`<button data-filter="failed">Failed (3)</button>`,
+		`data-outcome="passed" data-filter="passed">`,
+		`data-outcome="error" data-filter="failed" open>`,
+		"<code>GET http://api/users</code>",
+		"&#34;name&#34;: &#34;&lt;script&gt;&#34;",
+		"✓ status in [200]",
+		"/id: expected type &#34;string&#34;",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("HTML report missing %q", want)
+		}
+	}
+	if strings.Contains(out, "<link") || strings.Contains(out, " src=") {
+		t.Error("HTML report should not load external resources")
+	}
+}
+
+func TestFlakyReport(t *testing.T) {
+	report := testReport()
+	report.Results[0].Retried = []string{"assertions failed"}
+	report.Results[2].Retried = []string{"assertions failed", "assertions failed"}
+
+	var buf bytes.Buffer
+	WriteReport(&buf, "json", report)
+	var out jsonReport
+	json.Unmarshal(buf.Bytes(), &out)
+	if out.Summary.Flaky != 1 || !out.Results[0].Flaky || out.Results[0].Attempts != 2 || out.Results[2].Flaky || out.Results[2].Attempts != 3 {
+		t.Errorf("JSON flaky results = %+v", out)
+	}
+
+	buf.Reset()
+	WriteReport(&buf, "junit", report)
+	var doc junitTestsuites
+	xml.Unmarshal(buf.Bytes(), &doc)
+	tc := doc.Suites[0].Cases[0]
+	if len(tc.Properties) != 2 || tc.Properties[1] != (junitProperty{"flaky", "true"}) || tc.SystemOut != "HTTP 200\nAttempt 1: assertions failed" {
+		t.Errorf("JUnit flaky case = %+v", tc)
+	}
+
+	buf.Reset()
+	WriteReport(&buf, "tap", report)
+	if !strings.Contains(buf.String(), "ok 1 - users/GET # flaky, passed on attempt 2\n") || !strings.Contains(buf.String(), "  attempts: 3\n") {
+		t.Errorf("TAP flaky output:\n%s", buf.String())
+	}
+}
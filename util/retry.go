@@ -0,0 +1,56 @@
+package util
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultRetryDelay    = 500   // Milliseconds before the first retry
+	defaultMaxRetryDelay = 10000 // Milliseconds
+)
+
+// Retries configures how often lpost test retries a request that did not pass. Each retry
+// waits twice as long as the previous one, up to MaxDelay.
+type Retries struct {
+	Count    int `yaml:"count"`
+	Delay    int `yaml:"delay,omitempty"`     // Milliseconds before the first retry, default 500
+	MaxDelay int `yaml:"max-delay,omitempty"` // Milliseconds, default 10000
+}
+
+// UnmarshalYAML allows `retries: 2` as shorthand for the count.
+func (r *Retries) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var count int
+		if err := value.Decode(&count); err != nil {
+			return fmt.Errorf("invalid retries %q", value.Value)
+		}
+		*r = Retries{Count: count}
+	} else {
+		type plain Retries
+		if err := value.Decode((*plain)(r)); err != nil {
+			return err
+		}
+	}
+	if r.Count < 0 || r.Delay < 0 || r.MaxDelay < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+	return nil
+}
+
+// Backoff returns how long to wait before retry n, counted from 1.
+func (r Retries) Backoff(n int) time.Duration {
+	delay, maxDelay := r.Delay, r.MaxDelay
+	if delay == 0 {
+		delay = defaultRetryDelay
+	}
+	if maxDelay == 0 {
+		maxDelay = defaultMaxRetryDelay
+	}
+	for i := 1; i < n && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return time.Duration(min(delay, maxDelay)) * time.Millisecond
+}
@@ -0,0 +1,33 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRetriesBackoff(t *testing.T) {
+	var r Retries
+	if err := yaml.Unmarshal([]byte("3"), &r); err != nil || r.Count != 3 {
+		t.Fatalf("shorthand = %+v, %v", r, err)
+	}
+	if err := yaml.Unmarshal([]byte("{count: 4, delay: 100, max-delay: 300}"), &r); err != nil {
+		t.Fatal(err)
+	}
+	var delays []time.Duration
+	for n := 1; n <= r.Count; n++ {
+		delays = append(delays, r.Backoff(n))
+	}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}
+	if !reflect.DeepEqual(delays, expected) {
+		t.Errorf("backoff = %v, expected %v", delays, expected)
+	}
+	if (Retries{}).Backoff(1) != 500*time.Millisecond {
+		t.Errorf("default first delay = %v", (Retries{}).Backoff(1))
+	}
+	if err := yaml.Unmarshal([]byte("-1"), &r); err == nil {
+		t.Error("expected an error for negative retries")
+	}
+}
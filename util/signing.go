@@ -0,0 +1,300 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported signing types.
+const (
+	SigningSigV4 = "sigv4"
+	SigningHMAC  = "hmac"
+)
+
+// defaultHMACCanonical is the string signed by hmac signing when no canonical template is set.
+const defaultHMACCanonical = "{method}\n{path}\n{query}\n{timestamp}\n{body_sha256}"
+
+// defaultHMACHeaders are the headers set by hmac signing when none are configured.
+var defaultHMACHeaders = map[string]string{
+	"X-Timestamp": "{timestamp}",
+	"X-Signature": "{signature}",
+}
+
+// setsAuthorization reports whether signing writes the Authorization header, which leaves no
+// room for a digest auth answer.
+func (s *Signing) setsAuthorization() bool {
+	if s.Type == SigningSigV4 {
+		return true
+	}
+	headers := s.Headers
+	if len(headers) == 0 {
+		headers = defaultHMACHeaders
+	}
+	for name := range headers {
+		if strings.EqualFold(name, "Authorization") {
+			return true
+		}
+	}
+	return false
+}
+
+// signRequest signs req, whose body is body, as the last step before it is sent.
+// vars are the environment variables used to render the signing config.
+func signRequest(req *http.Request, body string, signing *Signing, vars map[string]string, now time.Time) error {
+	switch signing.Type {
+	case SigningSigV4:
+		return signSigV4(req, body, signing, vars, now)
+	case SigningHMAC:
+		return signHMAC(req, body, signing, vars, now)
+	default:
+		return fmt.Errorf("unsupported signing type %q (expected sigv4 or hmac)", signing.Type)
+	}
+}
+
+// renderSigningField resolves placeholders in a signing config value. Unlike request fields,
+// an unresolved placeholder is always an error: a request signed with a wrong key is useless.
+func renderSigningField(value, field string, vars map[string]string) (string, error) {
+	t := &templater{vars: vars}
+	rendered, err := t.renderString(value, "signing."+field)
+	if err != nil {
+		return "", err
+	}
+	if err := t.err(); err != nil {
+		return "", err
+	}
+	return rendered, nil
+}
+
+// signSigV4 implements AWS Signature Version 4 with the Authorization header.
+// Credentials default to AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+func signSigV4(req *http.Request, body string, signing *Signing, vars map[string]string, now time.Time) error {
+	fields := map[string]string{
+		"region":        signing.Region,
+		"service":       signing.Service,
+		"access_key":    signing.AccessKey,
+		"secret_key":    signing.SecretKey,
+		"session_token": signing.SessionToken,
+	}
+	fallbacks := map[string]string{
+		"access_key":    "AWS_ACCESS_KEY_ID",
+		"secret_key":    "AWS_SECRET_ACCESS_KEY",
+		"session_token": "AWS_SESSION_TOKEN",
+	}
+	for field, value := range fields {
+		if value == "" {
+			fields[field] = os.Getenv(fallbacks[field])
+			continue
+		}
+		rendered, err := renderSigningField(value, field, vars)
+		if err != nil {
+			return err
+		}
+		fields[field] = rendered
+	}
+	for _, required := range []string{"region", "service", "access_key", "secret_key"} {
+		if fields[required] == "" {
+			return fmt.Errorf("sigv4 signing requires %s", required)
+		}
+	}
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if fields["service"] == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	if fields["session_token"] != "" {
+		req.Header.Set("X-Amz-Security-Token", fields["session_token"])
+	}
+
+	// Sign host, content type and every x-amz-* header
+	signed := map[string]string{"host": req.URL.Host}
+	for key := range req.Header {
+		lower := strings.ToLower(key)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			signed[lower] = strings.Join(strings.Fields(strings.Join(req.Header.Values(key), ",")), " ")
+		}
+	}
+	names := make([]string, 0, len(signed))
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4Path(req.URL, fields["service"] != "s3"),
+		canonicalQuery(req.URL, awsURIEncode),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + fields["region"] + "/" + fields["service"] + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex(canonicalRequest)
+
+	key := hmacSum(sha256.New, []byte("AWS4"+fields["secret_key"]), date)
+	key = hmacSum(sha256.New, key, fields["region"])
+	key = hmacSum(sha256.New, key, fields["service"])
+	key = hmacSum(sha256.New, key, "aws4_request")
+	signature := hex.EncodeToString(hmacSum(sha256.New, key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		fields["access_key"], scope, signedHeaders, signature))
+	return nil
+}
+
+// signHMAC renders the canonical template, signs it with the shared secret and sets the
+// configured headers. Templates can use environment variables and these signing values:
+// {method}, {host}, {path}, {query} (sorted, encoded), {timestamp} (unix seconds),
+// {date} (RFC 3339), {nonce}, {body}, {body_sha256} and, in headers only, {signature}.
+func signHMAC(req *http.Request, body string, signing *Signing, vars map[string]string, now time.Time) error {
+	if signing.Secret == "" {
+		return fmt.Errorf("hmac signing requires secret")
+	}
+	secret, err := renderSigningField(signing.Secret, "secret", vars)
+	if err != nil {
+		return err
+	}
+
+	var newHash func() hash.Hash
+	switch signing.Algorithm {
+	case "", "sha256":
+		newHash = sha256.New
+	case "sha1":
+		newHash = sha1.New
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return fmt.Errorf("unsupported hmac algorithm %q (expected sha256, sha1 or sha512)", signing.Algorithm)
+	}
+
+	nonce, err := randomHex(16)
+	if err != nil {
+		return fmt.Errorf("error generating nonce: %v", err)
+	}
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	signingVars := make(map[string]string, len(vars)+10)
+	for key, value := range vars {
+		signingVars[key] = value
+	}
+	for key, value := range map[string]string{
+		"method":      req.Method,
+		"host":        req.URL.Host,
+		"path":        path,
+		"query":       canonicalQuery(req.URL, url.QueryEscape),
+		"timestamp":   strconv.FormatInt(now.Unix(), 10),
+		"date":        now.UTC().Format(time.RFC3339),
+		"nonce":       nonce,
+		"body":        body,
+		"body_sha256": sha256Hex(body),
+	} {
+		signingVars[key] = value
+	}
+
+	canonical := signing.Canonical
+	if canonical == "" {
+		canonical = defaultHMACCanonical
+	}
+	if canonical, err = renderSigningField(canonical, "canonical", signingVars); err != nil {
+		return err
+	}
+
+	sum := hmacSum(newHash, []byte(secret), canonical)
+	switch signing.Encoding {
+	case "", "hex":
+		signingVars["signature"] = hex.EncodeToString(sum)
+	case "base64":
+		signingVars["signature"] = base64.StdEncoding.EncodeToString(sum)
+	default:
+		return fmt.Errorf("unsupported hmac encoding %q (expected hex or base64)", signing.Encoding)
+	}
+
+	headers := signing.Headers
+	if len(headers) == 0 {
+		headers = defaultHMACHeaders
+	}
+	for name, template := range headers {
+		value, err := renderSigningField(template, "headers."+name, signingVars)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(name, value)
+	}
+	return nil
+}
+
+// canonicalQuery returns the query parameters sorted by key, then value, encoded with encode.
+func canonicalQuery(u *url.URL, encode func(string) string) string {
+	var pairs []string
+	for key, values := range u.Query() {
+		for _, value := range values {
+			pairs = append(pairs, encode(key)+"="+encode(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Path encodes each path segment, twice for every service except S3.
+func sigV4Path(u *url.URL, doubleEncode bool) string {
+	if u.Path == "" {
+		return "/"
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		segments[i] = awsURIEncode(segment)
+		if doubleEncode {
+			segments[i] = awsURIEncode(segments[i])
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// awsURIEncode percent-encodes everything except unreserved characters (RFC 3986).
+func awsURIEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSum(newHash func() hash.Hash, key []byte, data string) []byte {
+	mac := hmac.New(newHash, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,142 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignSigV4(t *testing.T) {
+	// Cases from the AWS Signature Version 4 test suite
+	signing := &Signing{
+		Type:      SigningSigV4,
+		Region:    "us-east-1",
+		Service:   "service",
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "{AWS_SECRET}",
+	}
+	vars := map[string]string{"AWS_SECRET": "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		url       string
+		signature string
+	}{
+		{"https://example.amazonaws.com/", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"https://example.amazonaws.com/?Param2=value2&Param1=value1", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		if err := signRequest(req, "", signing, vars, now); err != nil {
+			t.Fatalf("signRequest(%s) error: %v", tt.url, err)
+		}
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + tt.signature
+		if got := req.Header.Get("Authorization"); got != expected {
+			t.Errorf("Authorization for %s:\n got %s\nwant %s", tt.url, got, expected)
+		}
+	}
+}
+
+func TestSignHMAC(t *testing.T) {
+	secret := "s3cret"
+	// verifier checks the signature the way a gateway would
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodyHash := sha256.Sum256(body)
+		canonical := strings.Join([]string{r.Method, r.URL.Path, r.URL.Query().Encode(), r.Header.Get("X-Timestamp"), hex.EncodeToString(bodyHash[:])}, "\n")
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(canonical))
+		expected := "HMAC key-1:" + hex.EncodeToString(mac.Sum(nil))
+		if r.Header.Get("Authorization") != expected {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	signing := &Signing{
+		Type:   SigningHMAC,
+		Secret: "{API_SECRET}",
+		Headers: map[string]string{
+			"X-Timestamp":   "{timestamp}",
+			"Authorization": "HMAC {API_KEY}:{signature}",
+		},
+	}
+	vars := map[string]string{"API_SECRET": secret, "API_KEY": "key-1"}
+
+	body := `{"name":"test"}`
+	req, _ := http.NewRequest("POST", server.URL+"/items?b=2&a=1", strings.NewReader(body))
+	if err := signRequest(req, body, signing, vars, time.Now()); err != nil {
+		t.Fatalf("signRequest error: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("verifier rejected signature, status %d", resp.StatusCode)
+	}
+
+	delete(vars, "API_SECRET")
+	if err := signRequest(req, body, signing, vars, time.Now()); err == nil {
+		t.Errorf("expected error for unresolved secret")
+	}
+}
+
+func TestSigningInRequest(t *testing.T) {
+	t.Chdir(t.TempDir())
+	var signedUser string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signedUser = r.Header.Get("X-User")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	writeTestConfig(t, &Config{Env: "dev", Envs: map[string]Env{"dev": {
+		Vars: map[string]string{"BASE_URL": server.URL, "USER_ID": "from-env", "API_SECRET": "s3cret"},
+		Signing: &Signing{Type: SigningHMAC, Secret: "{API_SECRET}", Headers: map[string]string{
+			"X-User":      "{USER_ID}",
+			"X-Signature": "{signature}",
+		}},
+	}}})
+	writeRequests(t, map[string]string{
+		"users/{USER_ID}/GET.yaml": "",
+		"digest/GET.yaml":          "url: \"{BASE_URL}/digest\"\nauth:\n  type: digest\n  username: u\n  password: p\n",
+	})
+
+	// Signing templates see the same --param and path parameter values as the URL
+	path := filepath.Join(RequestsDir, "users", "{USER_ID}", "GET.yaml")
+	reqDef, err := readRequestDefinition(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := executeHTTPRequest(reqDef, path, RequestOptions{Params: map[string]string{"USER_ID": "42"}}, false)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	if !strings.HasSuffix(resp.ReqURL, "/users/42") || signedUser != "42" {
+		t.Errorf("sent %s signed for user %q, expected user 42 in both", resp.ReqURL, signedUser)
+	}
+
+	// Digest auth needs the Authorization header that sigv4 signing sets
+	writeTestConfig(t, &Config{Env: "dev", Envs: map[string]Env{"dev": {
+		Vars:    map[string]string{"BASE_URL": server.URL},
+		Signing: &Signing{Type: SigningSigV4, Region: "eu-west-1", Service: "execute-api", AccessKey: "a", SecretKey: "s"},
+	}}})
+	path = filepath.Join(RequestsDir, "digest", "GET.yaml")
+	if reqDef, err = readRequestDefinition(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executeHTTPRequest(reqDef, path, RequestOptions{}, false); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Errorf("expected digest auth with sigv4 signing to be rejected, got %v", err)
+	}
+}
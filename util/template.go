@@ -0,0 +1,394 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// placeholderPattern matches {NAME}, {NAME:-default}, {$generator args} and any of them
+// followed by |filters. Names are identifiers, so JSON-looking text such as {"a": 1} and
+// GraphQL selections such as {id name} are left alone.
+var placeholderPattern = regexp.MustCompile(`\{((?:\$[A-Za-z_][A-Za-z0-9_]*(?:\s[^{}|]*)?|[A-Za-z_][A-Za-z0-9_]*\s*(?::-[^{}|]*)?)(?:\|[^{}]*)?)\}`)
+
+// invalidPattern matches braces around a name with - or ., e.g. {user-id} or {user.id}. They
+// are not placeholders, but most likely mistyped ones, so strict mode reports them.
+var invalidPattern = regexp.MustCompile(`\{\$?[A-Za-z_][A-Za-z0-9_]*(?:[.-][A-Za-z0-9_]+)+\s*(?:(?::-|\|)[^{}]*)?\}`)
+
+// templatePattern matches placeholders and invalid ones, either escaped with a \ before the {
+// to be sent as written.
+var templatePattern = regexp.MustCompile(`\\?(?:` + placeholderPattern.String() + `|` + invalidPattern.String() + `)`)
+
+// typeFilters convert a placeholder that makes up a whole JSON string value into a typed value.
+var typeFilters = map[string]bool{"string": true, "number": true, "int": true, "float": true, "bool": true, "json": true}
+
+// templater resolves placeholders against a set of variables and records the ones it could not resolve.
+type templater struct {
+	vars       map[string]string
+	unresolved []unresolvedPlaceholder
+	invalid    []unresolvedPlaceholder
+}
+
+// unresolvedPlaceholder is a variable that was referenced but not defined, or an invalid placeholder.
+type unresolvedPlaceholder struct {
+	Name  string
+	Where string
+}
+
+// UnresolvedError lists every placeholder that could not be resolved in strict mode, and every
+// brace group that looks like a placeholder but is not a valid one.
+type UnresolvedError struct {
+	Placeholders []unresolvedPlaceholder
+	Invalid      []unresolvedPlaceholder
+}
+
+func (e *UnresolvedError) Error() string {
+	var lines []string
+	if len(e.Placeholders) > 0 {
+		lines = append(lines, "unresolved placeholders (define them, use {VAR:-default}, or run with --lenient):")
+		for _, p := range e.Placeholders {
+			lines = append(lines, fmt.Sprintf("  - {%s} in %s", p.Name, p.Where))
+		}
+	}
+	if len(e.Invalid) > 0 {
+		lines = append(lines, "invalid placeholders (names are letters, digits and _; write \\{ to send a brace as written, or run with --lenient):")
+		for _, p := range e.Invalid {
+			lines = append(lines, fmt.Sprintf("  - {%s} in %s", p.Name, p.Where))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// err returns an *UnresolvedError if a placeholder could not be resolved or was invalid.
+func (t *templater) err() error {
+	if len(t.unresolved) == 0 && len(t.invalid) == 0 {
+		return nil
+	}
+	return &UnresolvedError{Placeholders: t.unresolved, Invalid: t.invalid}
+}
+
+// renderRequest returns a copy of reqDef with every placeholder resolved: URL, headers and
+// all body kinds, including nested JSON objects and arrays. The original is left untouched,
+// so the same definition can be rendered again (e.g. when retrying after login).
+// In strict mode any undefined variable or invalid placeholder aborts with an *UnresolvedError
+// naming all of them.
+func renderRequest(reqDef RequestDefinition, vars map[string]string, strict bool) (RequestDefinition, error) {
+	t := &templater{vars: vars}
+	out, err := t.render(reqDef)
+	if err != nil {
+		return RequestDefinition{}, err
+	}
+	if err := t.err(); strict && err != nil {
+		return RequestDefinition{}, err
+	}
+	return out, nil
+}
+
+func (t *templater) render(reqDef RequestDefinition) (RequestDefinition, error) {
+	out := reqDef
+	var err error
+
+	if out.URL, err = t.renderURL(reqDef.URL, "url"); err != nil {
+		return RequestDefinition{}, err
+	}
+	if out.Query, err = t.renderQuery(reqDef.Query, "query"); err != nil {
+		return RequestDefinition{}, err
+	}
+	out.URL = appendQuery(out.URL, out.Query)
+
+	if reqDef.Headers != nil {
+		out.Headers = make(map[string]string, len(reqDef.Headers))
+		for key, value := range reqDef.Headers {
+			if out.Headers[key], err = t.renderString(value, "header "+key); err != nil {
+				return RequestDefinition{}, err
+			}
+		}
+	}
+
+	if reqDef.Body.Json != nil {
+		rendered, err := t.renderValue(reqDef.Body.Json, "body.json")
+		if err != nil {
+			return RequestDefinition{}, err
+		}
+		out.Body.Json = rendered.(map[string]interface{})
+	}
+	if out.Body.FormUrlEncoded, err = t.renderMap(reqDef.Body.FormUrlEncoded, "body.form-urlencoded"); err != nil {
+		return RequestDefinition{}, err
+	}
+	if out.Body.Form.Fields, err = t.renderMap(reqDef.Body.Form.Fields, "body.form-data.fields"); err != nil {
+		return RequestDefinition{}, err
+	}
+	if out.Body.Form.Files, err = t.renderMap(reqDef.Body.Form.Files, "body.form-data.files"); err != nil {
+		return RequestDefinition{}, err
+	}
+	if out.Body.Text, err = t.renderString(reqDef.Body.Text, "body.text"); err != nil {
+		return RequestDefinition{}, err
+	}
+
+	if reqDef.Auth != nil {
+		auth := *reqDef.Auth
+		fields := []struct {
+			name  string
+			value *string
+		}{
+			{"username", &auth.Username},
+			{"password", &auth.Password},
+			{"token", &auth.Token},
+			{"key", &auth.Key},
+			{"value", &auth.Value},
+		}
+		for _, f := range fields {
+			if *f.value, err = t.renderString(*f.value, "auth."+f.name); err != nil {
+				return RequestDefinition{}, err
+			}
+		}
+		out.Auth = &auth
+	}
+
+	return out, nil
+}
+
+// renderURL resolves placeholders in the URL. The query string is kept as written: it is not
+// re-encoded or reordered, so signed URLs stay valid. Use the urlencode filter for raw values.
+func (t *templater) renderURL(input, where string) (string, error) {
+	return t.renderString(input, where)
+}
+
+// renderQuery resolves placeholders in query parameter values.
+func (t *templater) renderQuery(in QueryParams, where string) (QueryParams, error) {
+	if in == nil {
+		return nil, nil
+	}
+	out := make(QueryParams, len(in))
+	for i, p := range in {
+		value, err := t.renderString(p.Value, where+"."+p.Key)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = QueryParam{Key: p.Key, Value: value}
+	}
+	return out, nil
+}
+
+func (t *templater) renderMap(in map[string]string, where string) (map[string]string, error) {
+	if in == nil {
+		return nil, nil
+	}
+	out := make(map[string]string, len(in))
+	for key, value := range in {
+		rendered, err := t.renderString(value, where+"."+key)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = rendered
+	}
+	return out, nil
+}
+
+// renderValue walks a decoded JSON/YAML value. A string that consists of exactly one
+// placeholder with a type filter, e.g. "{COUNT|number}", is replaced by a typed value.
+func (t *templater) renderValue(v interface{}, where string) (interface{}, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for key, child := range val {
+			rendered, err := t.renderValue(child, where+"."+key)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, child := range val {
+			rendered, err := t.renderValue(child, fmt.Sprintf("%s[%d]", where, i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	case string:
+		if loc := placeholderPattern.FindStringIndex(val); loc != nil && loc[0] == 0 && loc[1] == len(val) {
+			return t.renderTyped(val[1:len(val)-1], val, where)
+		}
+		return t.renderString(val, where)
+	default:
+		return v, nil
+	}
+}
+
+// renderTyped resolves a whole-value placeholder and converts it according to its type filter.
+func (t *templater) renderTyped(expr, original, where string) (interface{}, error) {
+	value, ok, err := t.eval(expr, where)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return original, nil
+	}
+	kind := typeFilterOf(expr)
+	converted, err := convertTyped(value, kind)
+	if err != nil {
+		return nil, fmt.Errorf("error converting {%s} in %s to %s: %v", expr, where, kind, err)
+	}
+	return converted, nil
+}
+
+// renderString replaces every placeholder in s with its string value. A placeholder escaped
+// as \{NAME} is sent as {NAME}, and invalid ones are recorded and sent as written.
+func (t *templater) renderString(s, where string) (string, error) {
+	var firstErr error
+	out := templatePattern.ReplaceAllStringFunc(s, func(match string) string {
+		if strings.HasPrefix(match, `\`) {
+			return match[1:]
+		}
+		if invalidPattern.MatchString(match) {
+			t.invalid = appendPlaceholder(t.invalid, match[1:len(match)-1], where)
+			return match
+		}
+		value, ok, err := t.eval(match[1:len(match)-1], where)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return match
+		}
+		if !ok {
+			return match
+		}
+		return value
+	})
+	return out, firstErr
+}
+
+// eval resolves the expression inside a placeholder: a variable name (optionally with a
+// ":-default") or a {$generator args...}, followed by optional filters, e.g. "NAME",
+// "PAGE:-1|int" or "$timestamp|sha256". ok is false when a referenced variable is not defined.
+func (t *templater) eval(expr, where string) (string, bool, error) {
+	parts := strings.Split(expr, "|")
+	head := strings.TrimSpace(parts[0])
+
+	var value string
+	if strings.HasPrefix(head, "$") {
+		words := splitArgs(head[1:])
+		if len(words) == 0 {
+			return "", false, fmt.Errorf("empty generator in {%s} in %s", expr, where)
+		}
+		generate, ok := generators[words[0]]
+		if !ok {
+			return "", false, fmt.Errorf("unknown generator $%s in %s", words[0], where)
+		}
+		args := make([]string, 0, len(words)-1)
+		for _, word := range words[1:] {
+			arg, _ := unquote(word)
+			args = append(args, arg)
+		}
+		generated, err := generate(args)
+		if err != nil {
+			return "", false, fmt.Errorf("error in {%s} in %s: %v", expr, where, err)
+		}
+		value = generated
+	} else {
+		name, fallback, hasDefault := strings.Cut(head, ":-")
+		name = strings.TrimSpace(name)
+		var ok bool
+		if value, ok = t.vars[name]; !ok {
+			if !hasDefault {
+				t.markUnresolved(name, where)
+				return "", false, nil
+			}
+			value, _ = unquote(strings.TrimSpace(fallback))
+		}
+	}
+
+	for _, part := range parts[1:] {
+		words := splitArgs(part)
+		if len(words) == 0 {
+			return "", false, fmt.Errorf("empty filter in {%s} in %s", expr, where)
+		}
+		if typeFilters[words[0]] {
+			continue
+		}
+		apply, ok := filters[words[0]]
+		if !ok {
+			return "", false, fmt.Errorf("unknown filter %q in {%s} in %s", words[0], expr, where)
+		}
+		// Quoted arguments are literals, bare words are variable names
+		args := make([]string, 0, len(words)-1)
+		for _, word := range words[1:] {
+			arg, quoted := unquote(word)
+			if !quoted {
+				if arg, ok = t.vars[word]; !ok {
+					t.markUnresolved(word, where)
+					return "", false, nil
+				}
+			}
+			args = append(args, arg)
+		}
+		filtered, err := apply(value, args)
+		if err != nil {
+			return "", false, fmt.Errorf("error in {%s} in %s: %v", expr, where, err)
+		}
+		value = filtered
+	}
+	return value, true, nil
+}
+
+func (t *templater) markUnresolved(name, where string) {
+	t.unresolved = appendPlaceholder(t.unresolved, name, where)
+}
+
+// appendPlaceholder adds a placeholder to list unless it is already in it.
+func appendPlaceholder(list []unresolvedPlaceholder, name, where string) []unresolvedPlaceholder {
+	for _, p := range list {
+		if p.Name == name && p.Where == where {
+			return list
+		}
+	}
+	return append(list, unresolvedPlaceholder{Name: name, Where: where})
+}
+
+// typeFilterOf returns the last type filter in expr, or "string" if none is present.
+func typeFilterOf(expr string) string {
+	kind := "string"
+	for _, filter := range strings.Split(expr, "|")[1:] {
+		if filter = strings.TrimSpace(filter); typeFilters[filter] {
+			kind = filter
+		}
+	}
+	return kind
+}
+
+// convertTyped converts a resolved value for a type filter. Integers stay int64 and JSON
+// numbers stay json.Number, so IDs above 2^53 are not rounded by a float64.
+func convertTyped(value, kind string) (interface{}, error) {
+	switch kind {
+	case "number", "float":
+		value = strings.TrimSpace(value)
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n, nil
+		}
+		return strconv.ParseFloat(value, 64)
+	case "int":
+		return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	case "bool":
+		return strconv.ParseBool(strings.TrimSpace(value))
+	case "json":
+		decoder := json.NewDecoder(strings.NewReader(value))
+		decoder.UseNumber()
+		var out interface{}
+		if err := decoder.Decode(&out); err != nil {
+			return nil, err
+		}
+		if rest := strings.TrimSpace(value[decoder.InputOffset():]); rest != "" {
+			return nil, fmt.Errorf("unexpected %q after the JSON value", rest)
+		}
+		return out, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,339 @@
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRenderRequest(t *testing.T) {
+	vars := map[string]string{
+		"BASE_URL": "https://api.example.com",
+		"NAME":     "alice",
+		"COUNT":    "3",
+		"ACTIVE":   "true",
+		"META":     `{"tier":"gold"}`,
+		"UPLOAD":   "/tmp/avatar.png",
+	}
+
+	reqDef := RequestDefinition{
+		URL:     "{BASE_URL}/users",
+		Headers: map[string]string{"X-User": "{NAME}"},
+		Body: Body{
+			Json: map[string]interface{}{
+				"user": map[string]interface{}{
+					"name":   "{NAME}",
+					"count":  "{COUNT|int}",
+					"active": "{ACTIVE|bool}",
+					"meta":   "{META|json}",
+					"tags":   []interface{}{"{NAME}-tag", 1},
+					"note":   "hi {NAME}, {UNKNOWN} stays",
+				},
+			},
+			FormUrlEncoded: map[string]string{"name": "{NAME}"},
+			Text:           `{"raw": true} for {NAME}`,
+		},
+	}
+	reqDef.Body.Form.Files = map[string]string{"avatar": "{UPLOAD}"}
+
+	rendered, err := renderRequest(reqDef, vars, false)
+	if err != nil {
+		t.Fatalf("renderRequest error: %v", err)
+	}
+
+	if rendered.URL != "https://api.example.com/users" {
+		t.Errorf("URL = %q", rendered.URL)
+	}
+	if rendered.Headers["X-User"] != "alice" {
+		t.Errorf("header = %q", rendered.Headers["X-User"])
+	}
+	expectedUser := map[string]interface{}{
+		"name":   "alice",
+		"count":  int64(3),
+		"active": true,
+		"meta":   map[string]interface{}{"tier": "gold"},
+		"tags":   []interface{}{"alice-tag", 1},
+		"note":   "hi alice, {UNKNOWN} stays",
+	}
+	if user := rendered.Body.Json["user"]; !reflect.DeepEqual(user, expectedUser) {
+		t.Errorf("json body = %#v, expected %#v", user, expectedUser)
+	}
+	if rendered.Body.FormUrlEncoded["name"] != "alice" {
+		t.Errorf("form-urlencoded = %q", rendered.Body.FormUrlEncoded["name"])
+	}
+	if rendered.Body.Form.Files["avatar"] != "/tmp/avatar.png" {
+		t.Errorf("form file = %q", rendered.Body.Form.Files["avatar"])
+	}
+	if rendered.Body.Text != `{"raw": true} for alice` {
+		t.Errorf("text = %q", rendered.Body.Text)
+	}
+
+	// The source definition must not be mutated
+	if reqDef.Headers["X-User"] != "{NAME}" {
+		t.Errorf("original headers were mutated")
+	}
+
+	if _, err := renderRequest(RequestDefinition{Body: Body{Json: map[string]interface{}{"n": "{NAME|int}"}}}, vars, false); err == nil {
+		t.Errorf("expected conversion error for non-numeric int")
+	}
+}
+
+func TestRenderStringFunctions(t *testing.T) {
+	tmpl := &templater{vars: map[string]string{
+		"USER":   "alice:secret",
+		"SECRET": "key",
+		"QUERY":  "a b&c",
+	}}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Basic {USER|base64}", "Basic YWxpY2U6c2VjcmV0"},
+		{"{QUERY|urlencode}", "a+b%26c"},
+		{"{USER|sha256}", "3d11dc479c08e3b368773103d64766c2e420ce39727932fcf2d8f4d9d599be59"},
+		{"{USER|hmac SECRET}", "cb609039f2f76a2ab4ecbf6a61b418bae376de37dbeba5b41cbf2d3dbc8d73da"},
+		{`{USER|hmac "key"}`, "cb609039f2f76a2ab4ecbf6a61b418bae376de37dbeba5b41cbf2d3dbc8d73da"},
+	}
+	for _, tt := range tests {
+		result, err := tmpl.renderString(tt.input, "test")
+		if err != nil {
+			t.Errorf("renderString(%q) error: %v", tt.input, err)
+		}
+		if result != tt.expected {
+			t.Errorf("renderString(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+
+	patterns := map[string]string{
+		"{$uuid}":             `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+		"{$timestamp}":        `^\d{10}$`,
+		"{$isoNow}":           `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`,
+		"{$randomInt 1 100}":  `^([1-9][0-9]?|100)$`,
+		"{$randomEmail}":      `^user-[0-9a-f]{10}@example\.com$`,
+		"{$timestamp|sha256}": `^[0-9a-f]{64}$`,
+		"{$randomString 5}-x": `^[0-9a-f]{5}-x$`,
+	}
+	for input, pattern := range patterns {
+		result, err := tmpl.renderString(input, "test")
+		if err != nil {
+			t.Errorf("renderString(%q) error: %v", input, err)
+		}
+		if !regexp.MustCompile(pattern).MatchString(result) {
+			t.Errorf("renderString(%q) = %q, expected to match %s", input, result, pattern)
+		}
+	}
+
+	// Ranges wider than int64 must not overflow
+	for _, input := range []string{"{$randomInt 0 9223372036854775807}", "{$randomInt -9223372036854775808 9223372036854775807}"} {
+		result, err := tmpl.renderString(input, "test")
+		if err != nil {
+			t.Errorf("renderString(%q) error: %v", input, err)
+		} else if _, err := strconv.ParseInt(result, 10, 64); err != nil {
+			t.Errorf("renderString(%q) = %q, expected an int64", input, result)
+		}
+	}
+
+	if _, err := tmpl.renderString("{$nope}", "test"); err == nil {
+		t.Errorf("expected error for unknown generator")
+	}
+	for _, input := range []string{"{$randomString 8 16}", "{$randomString 1000000000}", "{$randomString 0}"} {
+		if _, err := tmpl.renderString(input, "test"); err == nil {
+			t.Errorf("renderString(%q) should fail", input)
+		}
+	}
+}
+
+func TestRenderRequestStrict(t *testing.T) {
+	vars := map[string]string{"BASE_URL": "https://api.example.com"}
+	reqDef := RequestDefinition{
+		URL:     "{BASE_URL}/users?page={PAGE:-1}",
+		Headers: map[string]string{"Authorization": "Bearer {TOKEN}"},
+		Body: Body{Json: map[string]interface{}{
+			"user":  map[string]interface{}{"id": "{USER_ID}"},
+			"limit": "{LIMIT:-20|int}",
+		}},
+	}
+
+	_, err := renderRequest(reqDef, vars, true)
+	unresolved, ok := err.(*UnresolvedError)
+	if !ok {
+		t.Fatalf("expected *UnresolvedError, got %v", err)
+	}
+	expected := []unresolvedPlaceholder{
+		{Name: "TOKEN", Where: "header Authorization"},
+		{Name: "USER_ID", Where: "body.json.user.id"},
+	}
+	if !reflect.DeepEqual(unresolved.Placeholders, expected) {
+		t.Errorf("unresolved = %+v, expected %+v", unresolved.Placeholders, expected)
+	}
+
+	rendered, err := renderRequest(reqDef, vars, false)
+	if err != nil {
+		t.Fatalf("lenient renderRequest error: %v", err)
+	}
+	if rendered.URL != "https://api.example.com/users?page=1" {
+		t.Errorf("URL = %q", rendered.URL)
+	}
+	if rendered.Body.Json["limit"] != int64(20) {
+		t.Errorf("limit = %#v", rendered.Body.Json["limit"])
+	}
+	if rendered.Headers["Authorization"] != "Bearer {TOKEN}" {
+		t.Errorf("Authorization = %q", rendered.Headers["Authorization"])
+	}
+}
+
+func TestRenderBraceHeavyBodies(t *testing.T) {
+	vars := map[string]string{"USER_ID": "42"}
+	reqDef := RequestDefinition{
+		Body: Body{
+			Json: map[string]interface{}{
+				"query":     "{user{id name} posts(first: 10){edges{node{title body}}}}",
+				"variables": map[string]interface{}{"id": "{USER_ID|int}"},
+				"mustache":  "{{USER_ID}} is {{ user.id }}",
+			},
+			Text: `function f(a) { return {b: a}; } {"a":{"b":1}} is {USER_ID}`,
+		},
+	}
+
+	rendered, err := renderRequest(reqDef, vars, true)
+	if err != nil {
+		t.Fatalf("renderRequest error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"query":     "{user{id name} posts(first: 10){edges{node{title body}}}}",
+		"variables": map[string]interface{}{"id": int64(42)},
+		"mustache":  "{42} is {{ user.id }}",
+	}
+	if !reflect.DeepEqual(rendered.Body.Json, expected) {
+		t.Errorf("body.json = %#v", rendered.Body.Json)
+	}
+	if rendered.Body.Text != `function f(a) { return {b: a}; } {"a":{"b":1}} is 42` {
+		t.Errorf("body.text = %q", rendered.Body.Text)
+	}
+}
+
+func TestRenderLargeIntegers(t *testing.T) {
+	// 2^53 + 1 and a 19-digit ID, which a float64 would round
+	vars := map[string]string{"ID": "9007199254740993", "ORDER_ID": "1234567890123456789", "RATIO": "0.5", "DOC": `{"ids":[1234567890123456789]}`}
+	reqDef := RequestDefinition{Body: Body{Json: map[string]interface{}{
+		"id":    "{ID|number}",
+		"order": "{ORDER_ID|float}",
+		"ratio": "{RATIO|number}",
+		"doc":   "{DOC|json}",
+	}}}
+	rendered, err := renderRequest(reqDef, vars, true)
+	if err != nil {
+		t.Fatalf("renderRequest error: %v", err)
+	}
+	body, err := json.Marshal(rendered.Body.Json)
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	expected := `{"doc":{"ids":[1234567890123456789]},"id":9007199254740993,"order":1234567890123456789,"ratio":0.5}`
+	if string(body) != expected {
+		t.Errorf("body = %s, expected %s", body, expected)
+	}
+
+	if _, err := convertTyped(`{"a":1} }`, "json"); err == nil {
+		t.Error("expected an error for text after the JSON value")
+	}
+}
+
+func TestRenderEscapedAndInvalidPlaceholders(t *testing.T) {
+	vars := map[string]string{"USER_ID": "42"}
+	reqDef := RequestDefinition{
+		URL:     "http://api/users/{user-id}",
+		Headers: map[string]string{"X-Template": `\{USER_ID} is {USER_ID}`},
+		Body:    Body{Json: map[string]interface{}{"id": "{user.id|int}", "literal": `\{USER_ID|int}`}},
+	}
+
+	_, err := renderRequest(reqDef, vars, true)
+	unresolved, ok := err.(*UnresolvedError)
+	if !ok {
+		t.Fatalf("expected *UnresolvedError, got %v", err)
+	}
+	expected := []unresolvedPlaceholder{{Name: "user-id", Where: "url"}, {Name: "user.id|int", Where: "body.json.id"}}
+	if len(unresolved.Placeholders) != 0 || !reflect.DeepEqual(unresolved.Invalid, expected) {
+		t.Errorf("unresolved = %+v, invalid = %+v, expected invalid %+v", unresolved.Placeholders, unresolved.Invalid, expected)
+	}
+	if !strings.Contains(err.Error(), "invalid placeholders") {
+		t.Errorf("error should name the invalid placeholders: %v", err)
+	}
+
+	// Lenient mode sends invalid placeholders as written
+	rendered, err := renderRequest(reqDef, vars, false)
+	if err != nil {
+		t.Fatalf("lenient renderRequest error: %v", err)
+	}
+	if rendered.URL != "http://api/users/{user-id}" || rendered.Headers["X-Template"] != "{USER_ID} is 42" {
+		t.Errorf("rendered URL %q, header %q", rendered.URL, rendered.Headers["X-Template"])
+	}
+	if body := rendered.Body.Json; body["id"] != "{user.id|int}" || body["literal"] != "{USER_ID|int}" {
+		t.Errorf("body.json = %#v", body)
+	}
+}
+
+func TestRenderURLWithQueryParams(t *testing.T) {
+	vars := map[string]string{
+		"BASE_URL": "https://api.example.com",
+		"CAT":      "electronics",
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "{BASE_URL}/products/search?x=x",
+			expected: "https://api.example.com/products/search?x=x",
+		},
+		{
+			input:    "{BASE_URL}/products/search?category={CAT}&limit=10",
+			expected: "https://api.example.com/products/search?category=electronics&limit=10",
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := (&templater{vars: vars}).renderURL(tt.input, "url")
+		if err != nil {
+			t.Errorf("renderURL(%q) error: %v", tt.input, err)
+		}
+		if result != tt.expected {
+			t.Errorf("renderURL(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestRenderQuery(t *testing.T) {
+	var reqDef RequestDefinition
+	err := yaml.Unmarshal([]byte(`
+url: "{BASE_URL}/search?z=1&a={NAME}"
+query:
+  q: "{TERM}"
+  tag: [red, "{NAME}"]
+  empty:
+`), &reqDef)
+	if err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	vars := map[string]string{"BASE_URL": "https://api.example.com", "NAME": "alice", "TERM": "a&b c"}
+	rendered, err := renderRequest(reqDef, vars, true)
+	if err != nil {
+		t.Fatalf("renderRequest error: %v", err)
+	}
+	expected := "https://api.example.com/search?z=1&a=alice&q=a%26b+c&tag=red&tag=alice&empty="
+	if rendered.URL != expected {
+		t.Errorf("URL = %q, expected %q", rendered.URL, expected)
+	}
+
+	if got := appendQuery("https://x.io/p#frag", QueryParams{{Key: "k", Value: "v"}}); got != "https://x.io/p?k=v#frag" {
+		t.Errorf("appendQuery with fragment = %q", got)
+	}
+}
@@ -1,19 +1,54 @@
 package util
 
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
 // Response holds the results of an HTTP request execution.
 type Response struct {
+	ReqMethod   string              // HTTP method sent
 	ReqURL      string              // Final URL after env var substitution
 	ReqHeaders  map[string]string   // RequestDefinition headers sent
 	ReqBody     string              // RequestDefinition body sent
 	StatusCode  int                 // HTTP status (e.g., "200 OK")
 	RespHeaders map[string][]string // Response headers received
 	RespBody    string              // Response body received
+	Duration    time.Duration       // Time from sending the request to reading the full body
+	Assertions  []AssertionResult   // Results of the request's expect block
+	AuthRefresh *AuthRefresh        // Set when the request was replayed after an automatic login
+}
+
+// AuthRefresh records an automatic login triggered by a response status.
+type AuthRefresh struct {
+	TriggerStatus int      // Status of the first attempt that triggered the login
+	LoginRequest  string   // Path of the login request file, or the OAuth2 token URL
+	LoginResponse Response // Response of the login request
+}
+
+// AssertionResult is the outcome of a single expectation.
+type AssertionResult struct {
+	Name    string // Human readable description, e.g. "status in [200]"
+	Passed  bool
+	Message string // Failure reason, empty when passed
 }
 
-// Ephemeral holds runtime cookies and variables.
+// FailedAssertions returns only the assertions that did not pass.
+func (r Response) FailedAssertions() []AssertionResult {
+	var failed []AssertionResult
+	for _, a := range r.Assertions {
+		if !a.Passed {
+			failed = append(failed, a)
+		}
+	}
+	return failed
+}
+
+// Ephemeral holds runtime cookies and session variables. It is stored in the gitignored .ephemeral.yaml.
 type Ephemeral struct {
-	Cookies map[string]string `yaml:"cookies,omitempty"`
-	Vars    map[string]string `yaml:"vars,omitempty"`
+	Cookies CookieStore                  `yaml:"cookies,omitempty"` // Cookie jar per environment
+	Vars    map[string]map[string]string `yaml:"vars,omitempty"`    // Session variables per environment
 }
 
 // Env represents an environment with its persistent variables and login config.
@@ -21,25 +56,163 @@ type Env struct {
 	Name    string            `yaml:"-"`       // Current environment name
 	Vars    map[string]string `yaml:",inline"` // Persistent environment variables
 	Login   *LoginConfig      `yaml:"login,omitempty"`
+	Auth    *Auth             `yaml:"auth,omitempty"` // Default auth for every request in the environment
+	Signing *Signing          `yaml:"signing,omitempty"`
 	Timeout int               `yaml:"timeout,omitempty"`
+	Strict  *bool             `yaml:"strict,omitempty"` // Fail on unresolved placeholders; defaults to true
+
+	Resolved map[string]string `yaml:"-"` // Vars layered with globals, session and overrides, filled by LoadEnv
+}
+
+// StrictPlaceholders reports whether unresolved placeholders should abort a request.
+func (e Env) StrictPlaceholders() bool {
+	return e.Strict == nil || *e.Strict
 }
 
-// LoginConfig defines the login request and status codes for retry.
+// RequestOptions controls how HandleRequest executes and reports a request.
+type RequestOptions struct {
+	Verbose bool // Print request and response headers and bodies
+	Lenient bool // Send requests with unresolved placeholders instead of failing
+
+	Params map[string]string // Path parameter values; override variables of the same name
+}
+
+// LoginConfig defines how to log in, either with a login request or an OAuth2 token endpoint,
+// and the status codes that trigger a login and a retry.
 type LoginConfig struct {
-	Request     string `yaml:"request"`
-	TriggeredBy []int  `yaml:"triggered_by"`
+	Request     string        `yaml:"request,omitempty"` // Request path, e.g. auth/login/POST
+	OAuth2      *OAuth2Config `yaml:"oauth2,omitempty"`
+	TriggeredBy []int         `yaml:"triggered_by"` // Defaults to [401]
+}
+
+// OAuth2Config fetches an access token from a token endpoint. String fields support placeholders.
+type OAuth2Config struct {
+	Grant         string `yaml:"grant"` // client_credentials, password or refresh_token
+	TokenURL      string `yaml:"token_url"`
+	ClientID      string `yaml:"client_id,omitempty"`
+	ClientSecret  string `yaml:"client_secret,omitempty"`
+	ClientAuth    string `yaml:"client_auth,omitempty"` // body (default) or basic
+	Scope         string `yaml:"scope,omitempty"`
+	Username      string `yaml:"username,omitempty"`       // password grant
+	Password      string `yaml:"password,omitempty"`       // password grant
+	RefreshToken  string `yaml:"refresh_token,omitempty"`  // refresh_token grant, used until the server issues a new one
+	TokenVar      string `yaml:"token_var,omitempty"`      // Session variable for the token; defaults to ACCESS_TOKEN
+	RefreshBefore int    `yaml:"refresh_before,omitempty"` // Seconds before expiry to fetch a new token; defaults to 30
+}
+
+// Triggers reports whether status should trigger a login and a retry.
+func (l LoginConfig) Triggers(status int) bool {
+	if len(l.TriggeredBy) == 0 {
+		return status == http.StatusUnauthorized
+	}
+	return slices.Contains(l.TriggeredBy, status)
+}
+
+// QueryParams are query parameters appended to the request URL, in file order.
+type QueryParams []QueryParam
+
+// QueryParam is a single query parameter. Key and Value are not encoded.
+type QueryParam struct {
+	Key   string
+	Value string
+}
+
+// Signing signs every request of an environment after its body is built. Values support placeholders.
+type Signing struct {
+	Type string `yaml:"type"` // sigv4 or hmac
+
+	// sigv4; credentials default to the AWS_* environment variables
+	Region       string `yaml:"region,omitempty"`
+	Service      string `yaml:"service,omitempty"`
+	AccessKey    string `yaml:"access_key,omitempty"`
+	SecretKey    string `yaml:"secret_key,omitempty"`
+	SessionToken string `yaml:"session_token,omitempty"`
+
+	// hmac
+	Secret    string            `yaml:"secret,omitempty"`
+	Algorithm string            `yaml:"algorithm,omitempty"` // sha256 (default), sha1 or sha512
+	Encoding  string            `yaml:"encoding,omitempty"`  // hex (default) or base64
+	Canonical string            `yaml:"canonical,omitempty"` // Template of the signed string
+	Headers   map[string]string `yaml:"headers,omitempty"`   // Header templates, may use {signature}
 }
 
 // RequestDefinition defines an HTTP request from a YAML file.
 type RequestDefinition struct {
-	Method  string            // Not in YAML, from filename
-	URL     string            `yaml:"url,omitempty"` // Optional
-	Headers map[string]string `yaml:"headers,omitempty"`
-	Body    Body              `yaml:"body,omitempty"`
-	SetEnv  map[string]struct {
-		Header string `yaml:"header,omitempty"`
-		Body   string `yaml:"body,omitempty"`
-	} `yaml:"set-env-var,omitempty"`
+	Method    string                  // Not in YAML, from filename
+	URL       string                  `yaml:"url,omitempty"` // Optional
+	Query     QueryParams             `yaml:"query,omitempty"`
+	Headers   map[string]string       `yaml:"headers,omitempty"`
+	Body      Body                    `yaml:"body,omitempty"`
+	SetEnv    map[string]SetEnvSource `yaml:"set-env-var,omitempty"`
+	Expect    *Expect                 `yaml:"expect,omitempty"`
+	Auth      *Auth                   `yaml:"auth,omitempty"`       // Overrides the environment's auth; "none" disables it
+	Tags      []string                `yaml:"tags,omitempty"`       // For selecting requests with lpost test --tag
+	DependsOn []string                `yaml:"depends-on,omitempty"` // Requests lpost test runs first, e.g. /users/POST
+	Retries   *Retries                `yaml:"retries,omitempty"`    // How often lpost test retries the request if it does not pass
+	Schema    *SchemaHints            `yaml:"schema,omitempty"`
+}
+
+// SchemaHints tune how the baseline is inferred from recorded responses. Paths are dot separated
+// property names from the response root, where * matches any property or array element.
+type SchemaHints struct {
+	Format         string   `yaml:"format,omitempty"`         // jtd (default) or json-schema
+	Samples        int      `yaml:"samples,omitempty"`        // Responses kept for inference, default 20
+	Enums          []string `yaml:"enums,omitempty"`          // Strings inferred as an enum of the values seen
+	Discriminators []string `yaml:"discriminators,omitempty"` // Tag properties of tagged unions, e.g. events.*.type
+	Optional       []string `yaml:"optional,omitempty"`       // Properties that may be missing even if every sample has them
+	Timestamps     *bool    `yaml:"timestamps,omitempty"`     // Infer RFC 3339 strings as timestamps; defaults to true
+}
+
+// Auth configures credentials added to a request. Fields support placeholders.
+type Auth struct {
+	Type     string `yaml:"type"`               // basic, bearer, api-key, digest or none
+	Username string `yaml:"username,omitempty"` // basic, digest
+	Password string `yaml:"password,omitempty"` // basic, digest
+	Token    string `yaml:"token,omitempty"`    // bearer
+	Key      string `yaml:"key,omitempty"`      // api-key: header or query parameter name
+	Value    string `yaml:"value,omitempty"`    // api-key
+	In       string `yaml:"in,omitempty"`       // api-key: header (default) or query
+}
+
+// SetEnvSource selects where a set-env-var value is captured from. Exactly one source should be set.
+type SetEnvSource struct {
+	Header string `yaml:"header,omitempty"` // Response header name
+	Body   string `yaml:"body,omitempty"`   // JSONPath into the response body, e.g. data.items[0].id
+	Status bool   `yaml:"status,omitempty"` // Response status code
+	Cookie string `yaml:"cookie,omitempty"` // Cookie name from Set-Cookie
+	Regex  string `yaml:"regex,omitempty"`  // Regex over the raw body; first capture group if any
+
+	Persist bool `yaml:"persist,omitempty"` // Write to config.yaml instead of the session store
+}
+
+// Expect defines declarative assertions evaluated against the response.
+type Expect struct {
+	Status  StatusList              `yaml:"status,omitempty"`
+	Headers map[string]HeaderExpect `yaml:"headers,omitempty"`
+	Body    BodyExpects             `yaml:"body,omitempty"`     // Keyed by JSONPath, e.g. $.data.id
+	MaxTime int                     `yaml:"max-time,omitempty"` // Milliseconds
+}
+
+// BodyExpects maps JSONPaths to their expectations. A path mapped to null expects a JSON null.
+type BodyExpects map[string]BodyExpect
+
+// StatusList accepts either a single status code or a list of codes.
+type StatusList []int
+
+// HeaderExpect asserts on a response header. A plain string is shorthand for equals.
+type HeaderExpect struct {
+	Equals  string `yaml:"equals,omitempty"`
+	Matches string `yaml:"matches,omitempty"`
+}
+
+// BodyExpect asserts on a value selected from the JSON response body.
+// A plain scalar is shorthand for equals.
+type BodyExpect struct {
+	Equals  interface{} `yaml:"equals,omitempty"`
+	Matches string      `yaml:"matches,omitempty"`
+	Exists  *bool       `yaml:"exists,omitempty"`
+
+	hasEquals bool // Whether equals was given, since an expected null decodes to a nil Equals
 }
 
 // Body represents the request body content.
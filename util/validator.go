@@ -0,0 +1,239 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	jtd "github.com/jsontypedef/json-typedef-go"
+)
+
+// Supported baseline schema formats.
+const (
+	FormatJTD        = "jtd"
+	FormatJSONSchema = "json-schema"
+)
+
+// SchemaFormat is a kind of baseline schema: how it is stored, inferred and validated against.
+type SchemaFormat interface {
+	Name() string
+	// Extension is the suffix of baseline files, e.g. .jtd.json.
+	Extension() string
+	// Infer builds a schema from JSON response bodies, formatted as stored on disk.
+	Infer(bodies []string, hints SchemaHints) ([]byte, error)
+	// Validate checks a decoded JSON document against schema. The error is for an unusable schema.
+	Validate(schema []byte, doc interface{}) ([]ValidationError, error)
+}
+
+// schemaFormats are the known formats, in the order existing baselines are looked up.
+var schemaFormats = []SchemaFormat{jtdFormat{}, jsonSchemaFormat{}}
+
+// ValidationError is a part of a response that does not match its baseline.
+// Both paths are JSON Pointers (RFC 6901), e.g. /users/0/id.
+type ValidationError struct {
+	InstancePath string `json:"instance_path"`
+	SchemaPath   string `json:"schema_path"`
+	Message      string `json:"message"`
+}
+
+func (e ValidationError) String() string {
+	path := e.InstancePath
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("%s: %s (schema %s)", path, e.Message, e.SchemaPath)
+}
+
+// schemaFormatNamed returns the format with the given name; an empty name is JTD.
+func schemaFormatNamed(name string) (SchemaFormat, error) {
+	if name == "" {
+		return jtdFormat{}, nil
+	}
+	for _, format := range schemaFormats {
+		if format.Name() == name {
+			return format, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported schema format %q (expected jtd or json-schema)", name)
+}
+
+// SchemaFormatOf returns the format of a baseline file from its extension.
+func SchemaFormatOf(schemaPath string) SchemaFormat {
+	for _, format := range schemaFormats {
+		if strings.HasSuffix(schemaPath, format.Extension()) {
+			return format
+		}
+	}
+	return jtdFormat{}
+}
+
+// baselineFormat picks the format of a request's baseline for a status: the format set in the
+// request's schema block, else the format of an existing baseline, else the format the other
+// baselines in the request folder use, else JTD.
+func baselineFormat(filePath string, status int) SchemaFormat {
+	if hints, err := readSchemaHints(filePath); err == nil && hints.Format != "" {
+		if format, err := schemaFormatNamed(hints.Format); err == nil {
+			return format
+		}
+	}
+	stem := baselineStem(filePath, status)
+	for _, format := range schemaFormats {
+		if _, err := os.Stat(stem + format.Extension()); err == nil {
+			return format
+		}
+	}
+	if entries, err := os.ReadDir(filepath.Dir(filePath)); err == nil {
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), jsonSchemaFormat{}.Extension()) {
+				return jsonSchemaFormat{}
+			}
+		}
+	}
+	return jtdFormat{}
+}
+
+// jsonPointer joins path tokens into a JSON Pointer, escaping ~ and /.
+func jsonPointer(tokens []string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString("/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return b.String()
+}
+
+// sortValidationErrors orders errors by location, so output does not depend on map order.
+func sortValidationErrors(errs []ValidationError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].InstancePath != errs[j].InstancePath {
+			return errs[i].InstancePath < errs[j].InstancePath
+		}
+		return errs[i].SchemaPath < errs[j].SchemaPath
+	})
+}
+
+// jtdFormat is JSON Type Definition (RFC 8927), the default baseline format.
+type jtdFormat struct{}
+
+func (jtdFormat) Name() string      { return FormatJTD }
+func (jtdFormat) Extension() string { return ".jtd.json" }
+
+func (jtdFormat) Infer(bodies []string, hints SchemaHints) ([]byte, error) {
+	return InferBaseline(bodies, hints)
+}
+
+func (jtdFormat) Validate(schemaData []byte, doc interface{}) ([]ValidationError, error) {
+	var schema jtd.Schema
+	if err := json.Unmarshal(schemaData, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema format: %v", err)
+	}
+	if err := schema.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	var raw interface{}
+	if err := json.Unmarshal(schemaData, &raw); err != nil {
+		return nil, fmt.Errorf("invalid schema format: %v", err)
+	}
+
+	validateErrors, err := jtd.Validate(schema, doc)
+	if err != nil {
+		return nil, err
+	}
+	errs := make([]ValidationError, 0, len(validateErrors))
+	for _, e := range validateErrors {
+		errs = append(errs, ValidationError{
+			InstancePath: jsonPointer(e.InstancePath),
+			SchemaPath:   jsonPointer(e.SchemaPath),
+			Message:      jtdErrorMessage(e, raw),
+		})
+	}
+	sortValidationErrors(errs)
+	return errs, nil
+}
+
+// jtdErrorMessage describes a JTD error from the keyword its schema path ends in.
+func jtdErrorMessage(e jtd.ValidateError, schema interface{}) string {
+	if isAdditionalProperty(e, schema) {
+		return "unexpected property"
+	}
+	path := e.SchemaPath
+	if len(path) >= 2 && path[len(path)-2] == "properties" {
+		return fmt.Sprintf("missing required property %q", path[len(path)-1])
+	}
+	last := ""
+	if len(path) > 0 {
+		last = path[len(path)-1]
+	}
+	switch last {
+	case "type":
+		return fmt.Sprintf("expected type %s", compactJSON(lookupPointer(schema, path)))
+	case "enum":
+		return fmt.Sprintf("expected one of %s", compactJSON(lookupPointer(schema, path)))
+	case "elements":
+		return "expected an array"
+	case "values", "properties", "optionalProperties":
+		return "expected an object"
+	case "discriminator":
+		return "expected an object with a string discriminator"
+	case "mapping":
+		return "unknown discriminator value"
+	default:
+		return "unexpected property"
+	}
+}
+
+// isAdditionalProperty reports whether e is a property the schema does not allow. JTD reports
+// those with the schema path of the enclosing properties form, and the property one level below
+// the instance that form describes.
+func isAdditionalProperty(e jtd.ValidateError, schema interface{}) bool {
+	depth := 0 // Instance depth of the form at the schema path
+	for i := 0; i < len(e.SchemaPath); i++ {
+		switch e.SchemaPath[i] {
+		case "properties", "optionalProperties":
+			depth++
+			i++ // Property name
+		case "elements", "values":
+			depth++
+		case "mapping", "definitions":
+			i++ // Variant or definition name, same instance
+		}
+	}
+	if len(e.InstancePath) != depth+1 {
+		return false
+	}
+	form, ok := lookupPointer(schema, e.SchemaPath).(map[string]interface{})
+	if !ok {
+		return false
+	}
+	key := e.InstancePath[len(e.InstancePath)-1]
+	for _, keyword := range []string{"properties", "optionalProperties"} {
+		if props, ok := form[keyword].(map[string]interface{}); ok {
+			if _, ok := props[key]; ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lookupPointer returns the value at path in a decoded JSON document, or nil.
+func lookupPointer(doc interface{}, path []string) interface{} {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			doc = node[token]
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			doc = node[i]
+		default:
+			return nil
+		}
+	}
+	return doc
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJTDValidate(t *testing.T) {
+	schema := []byte(`{"properties":{"id":{"type":"uint8"},"tags":{"elements":{"enum":["a","b"]}}}}`)
+	var doc interface{}
+	json.Unmarshal([]byte(`{"id":"x","tags":["a","c"],"extra":1}`), &doc)
+
+	errs, err := jtdFormat{}.Validate(schema, doc)
+	if err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+	expected := []ValidationError{
+		{"/extra", "", "unexpected property"},
+		{"/id", "/properties/id/type", `expected type "uint8"`},
+		{"/tags/1", "/properties/tags/elements/enum", `expected one of ["a","b"]`},
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Validate =\n%v\nexpected\n%v", errs, expected)
+	}
+
+	json.Unmarshal([]byte(`{"tags":[]}`), &doc)
+	errs, _ = jtdFormat{}.Validate(schema, doc)
+	if len(errs) != 1 || errs[0].Message != `missing required property "id"` || errs[0].InstancePath != "" {
+		t.Errorf("expected a missing id at the root, got %v", errs)
+	}
+}
+
+func TestJTDValidateAdditionalProperties(t *testing.T) {
+	schema := []byte(`{"properties":{"a":{"properties":{"b":{"type":"string"}}},"items":{"elements":{"properties":{"id":{"type":"uint8"}},"optionalProperties":{"name":{"type":"string"}}}}}}`)
+	tests := []struct {
+		doc      string
+		expected ValidationError
+	}{
+		{`{"a":{"b":"x","extra":1},"items":[]}`, ValidationError{"/a/extra", "/properties/a", "unexpected property"}},
+		{`{"a":{"b":"x"},"items":[{"id":1,"name":"n","bogus":true}]}`, ValidationError{"/items/0/bogus", "/properties/items/elements", "unexpected property"}},
+		{`{"a":{},"items":[]}`, ValidationError{"/a", "/properties/a/properties/b", `missing required property "b"`}},
+	}
+	for _, tt := range tests {
+		var doc interface{}
+		json.Unmarshal([]byte(tt.doc), &doc)
+		errs, err := jtdFormat{}.Validate(schema, doc)
+		if err != nil {
+			t.Fatalf("Validate error: %v", err)
+		}
+		if len(errs) != 1 || errs[0] != tt.expected {
+			t.Errorf("Validate(%s) = %v, expected %v", tt.doc, errs, tt.expected)
+		}
+	}
+}
+
+func TestBaselineFormat(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := filepath.Join(RequestsDir, "users")
+	os.MkdirAll(dir, 0755)
+	get := filepath.Join(dir, "GET.yaml")
+	post := filepath.Join(dir, "POST.yaml")
+	os.WriteFile(get, []byte("{}"), 0644)
+	os.WriteFile(post, []byte("schema:\n  format: json-schema\n"), 0644)
+
+	if got := StatusSchemaPath(get, 200); got != filepath.Join(dir, "GET.jtd.json") {
+		t.Errorf("default baseline = %q, expected JTD", got)
+	}
+	if got := StatusSchemaPath(post, 404); got != filepath.Join(dir, "POST.404.schema.json") {
+		t.Errorf("baseline with format hint = %q", got)
+	}
+
+	// A folder with JSON Schema baselines keeps using them
+	os.WriteFile(filepath.Join(dir, "POST.schema.json"), []byte("{}"), 0644)
+	if got := StatusSchemaPath(get, 200); got != filepath.Join(dir, "GET.schema.json") {
+		t.Errorf("baseline in a JSON Schema folder = %q", got)
+	}
+	// An existing baseline wins over the folder
+	os.WriteFile(filepath.Join(dir, "GET.jtd.json"), []byte("{}"), 0644)
+	if got := StatusSchemaPath(get, 200); got != filepath.Join(dir, "GET.jtd.json") {
+		t.Errorf("existing JTD baseline = %q", got)
+	}
+}
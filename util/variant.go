@@ -0,0 +1,70 @@
+package util
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SplitRequestName splits a request file name without .yaml, such as POST, POST.invalid-email
+// or POST@admin, into its HTTP method and variant name. Variants share the method and URL of
+// their directory but have their own body, expectations and schema. An invalid variant name
+// is returned together with an error.
+func SplitRequestName(name string) (method, variant string, err error) {
+	i := strings.IndexAny(name, ".@")
+	if i == -1 {
+		return name, "", nil
+	}
+	method, variant = name[:i], name[i+1:]
+	return method, variant, ValidateVariantName(variant)
+}
+
+// ValidateVariantName rejects variant names made of digits only or containing . or @.
+// POST.400.yaml would share POST.400.jtd.json and POST.400.jsonl with the status 400 baseline
+// of POST.yaml, and POST.invalid.404.yaml those of the status 404 baseline of POST.invalid.yaml.
+func ValidateVariantName(variant string) error {
+	if variant != "" && strings.Trim(variant, "0123456789") == "" {
+		return fmt.Errorf("variant name %q is all digits, which clashes with the baselines of status %s", variant, variant)
+	}
+	if i := strings.IndexAny(variant, ".@"); i != -1 {
+		return fmt.Errorf("variant name %q contains %q, which clashes with the baselines of other variants; use - instead", variant, variant[i])
+	}
+	return nil
+}
+
+// SchemaPath returns the path of the schema baseline stored next to a request file for 2xx
+// responses. Each variant has its own, e.g. POST@admin.yaml uses POST@admin.jtd.json.
+func SchemaPath(filePath string) string {
+	return StatusSchemaPath(filePath, 200)
+}
+
+// StatusSchemaPath returns the baseline responses with the given status are validated against:
+// POST.jtd.json for any 2xx status, and POST.404.jtd.json and the like for every other status.
+// JSON Schema baselines end in .schema.json instead, see baselineFormat.
+func StatusSchemaPath(filePath string, status int) string {
+	return baselineStem(filePath, status) + baselineFormat(filePath, status).Extension()
+}
+
+// baselineStem returns the baseline path of a request file for a status, without extension.
+func baselineStem(filePath string, status int) string {
+	stem := strings.TrimSuffix(filePath, ".yaml")
+	if isSuccessStatus(status) {
+		return stem
+	}
+	return stem + "." + strconv.Itoa(status)
+}
+
+func isSuccessStatus(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// ExpectsStatus reports whether a response status is part of a request's contract: any 2xx,
+// or a status listed in the request's expect.status.
+func ExpectsStatus(filePath string, status int) bool {
+	if isSuccessStatus(status) {
+		return true
+	}
+	meta, err := readRequestMeta(filePath)
+	return err == nil && slices.Contains(meta.Expect.Status, status)
+}
@@ -0,0 +1,89 @@
+package util
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitRequestName(t *testing.T) {
+	tests := []struct {
+		name, method, variant, schema string
+	}{
+		{"POST", "POST", "", "users/POST.jtd.json"},
+		{"POST.invalid-email", "POST", "invalid-email", "users/POST.invalid-email.jtd.json"},
+		{"POST@admin", "POST", "admin", "users/POST@admin.jtd.json"},
+	}
+	for _, tt := range tests {
+		method, variant, err := SplitRequestName(tt.name)
+		if err != nil || method != tt.method || variant != tt.variant {
+			t.Errorf("SplitRequestName(%q) = %q, %q, %v, expected %q, %q", tt.name, method, variant, err, tt.method, tt.variant)
+		}
+		if got := SchemaPath("users/" + tt.name + ".yaml"); got != tt.schema {
+			t.Errorf("SchemaPath(%q) = %q, expected %q", tt.name, got, tt.schema)
+		}
+	}
+}
+
+func TestDigitVariantNames(t *testing.T) {
+	// POST.400.yaml would share its baseline with the status 400 responses of POST.yaml
+	for _, name := range []string{"POST.400", "POST@404", "GET.2"} {
+		if _, _, err := SplitRequestName(name); err == nil {
+			t.Errorf("SplitRequestName(%q) should reject an all-digit variant", name)
+		}
+	}
+	// POST.invalid.404.yaml would share POST.invalid.404.jtd.json with the status 404 baseline of POST.invalid.yaml
+	for _, name := range []string{"POST.invalid.404", "POST@admin.v2", "POST.a@b"} {
+		if _, _, err := SplitRequestName(name); err == nil {
+			t.Errorf("SplitRequestName(%q) should reject a variant containing . or @", name)
+		}
+	}
+	if StatusSchemaPath("users/POST.invalid.yaml", 404) != "users/POST.invalid.404.jtd.json" {
+		t.Error("the status 404 baseline of POST.invalid.yaml should be POST.invalid.404.jtd.json")
+	}
+	for _, variant := range []string{"", "v2", "400-missing-email"} {
+		if err := ValidateVariantName(variant); err != nil {
+			t.Errorf("ValidateVariantName(%q) error: %v", variant, err)
+		}
+	}
+}
+
+func TestStatusSchemaPath(t *testing.T) {
+	tests := map[int]string{
+		200: "users/POST@admin.jtd.json",
+		201: "users/POST@admin.jtd.json",
+		404: "users/POST@admin.404.jtd.json",
+		500: "users/POST@admin.500.jtd.json",
+	}
+	for status, expected := range tests {
+		if got := StatusSchemaPath("users/POST@admin.yaml", status); got != expected {
+			t.Errorf("StatusSchemaPath(%d) = %q, expected %q", status, got, expected)
+		}
+	}
+}
+
+func TestExpectsStatus(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeRequests(t, map[string]string{
+		"users/DELETE.yaml": "expect:\n  status: [204, 404]\n",
+		"users/GET.yaml":    "expect:\n  status: 200\n",
+	})
+	del := filepath.Join(RequestsDir, "users", "DELETE.yaml")
+	get := filepath.Join(RequestsDir, "users", "GET.yaml")
+	tests := []struct {
+		path     string
+		status   int
+		expected bool
+	}{
+		{del, 204, true},
+		{del, 404, true},
+		{del, 500, false},
+		{get, 201, true},
+		{get, 404, false},
+		{filepath.Join(RequestsDir, "missing", "GET.yaml"), 404, false},
+	}
+	for _, tt := range tests {
+		if got := ExpectsStatus(tt.path, tt.status); got != tt.expected {
+			t.Errorf("ExpectsStatus(%s, %d) = %v, expected %v", tt.path, tt.status, got, tt.expected)
+		}
+	}
+}